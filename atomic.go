@@ -0,0 +1,197 @@
+package regex
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileOptions changes how the Atomic file methods replace a file
+type FileOptions struct {
+	// MaxReSize is the max length of a match (default: 10x the length of the regex, min 1024)
+	MaxReSize int64
+
+	// KeepOwner keeps the user and group of the original file
+	// (this usually needs root when the file is owned by another user, and is ignored on windows)
+	KeepOwner bool
+
+	// KeepModTime keeps the modification time of the original file
+	KeepModTime bool
+
+	// Journal keeps a backup of the file before it is replaced, so the change can be undone
+	// (default: the journal from SetJournal)
+	Journal *Journal
+}
+
+//* PCRE atomic file methods
+
+// RepFileStrAtomic replaces a regex match with a new []byte in a file, the same as RepFileStr
+//
+// the result is written to a temp file in the same directory, synced to disk, and then renamed over the original file,
+// so the file is never left half written, even if the process dies
+//
+// the permissions of the file are always kept, use @opts to also keep the owner and mtime
+//
+// unlike RepFileStr, this method returns the number of replacements, and only returns an error if something failed
+// (if there is no match, the file is not touched)
+//
+// @all: if true, will replace all text matching @re,
+// if false, will only replace the first occurrence
+func (reg *Regexp) RepFileStrAtomic(path string, rep []byte, all bool, opts ...FileOptions) (int, error) {
+	return repFileAtomic(context.Background(), reg, reg.len, path, all, opts, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFileFuncAtomic replaces a regex match with the result of a function in a file, the same as RepFileFunc
+//
+// the result is written to a temp file in the same directory, synced to disk, and then renamed over the original file,
+// so the file is never left half written, even if the process dies
+//
+// the permissions of the file are always kept, use @opts to also keep the owner and mtime
+//
+// unlike RepFileFunc, this method returns the number of replacements, and only returns an error if something failed
+// (if there is no match, the file is not touched)
+//
+// @all: if true, will replace all text matching @re,
+// if false, will only replace the first occurrence
+func (reg *Regexp) RepFileFuncAtomic(path string, rep func(data func(int) []byte) []byte, all bool, opts ...FileOptions) (int, error) {
+	return repFileAtomic(context.Background(), reg, reg.len, path, all, opts, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+//* RE2 atomic file methods
+
+// RepFileStrAtomic replaces a regex match with a new []byte in a file, the same as RepFileStr
+//
+// the result is written to a temp file in the same directory, synced to disk, and then renamed over the original file,
+// so the file is never left half written, even if the process dies
+//
+// the permissions of the file are always kept, use @opts to also keep the owner and mtime
+//
+// unlike RepFileStr, this method returns the number of replacements, and only returns an error if something failed
+// (if there is no match, the file is not touched)
+//
+// @all: if true, will replace all text matching @re,
+// if false, will only replace the first occurrence
+func (reg *RegexpRE2) RepFileStrAtomic(path string, rep []byte, all bool, opts ...FileOptions) (int, error) {
+	return repFileAtomic(context.Background(), reg, reg.len, path, all, opts, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFileFuncAtomic replaces a regex match with the result of a function in a file, the same as RepFileFunc
+//
+// the result is written to a temp file in the same directory, synced to disk, and then renamed over the original file,
+// so the file is never left half written, even if the process dies
+//
+// the permissions of the file are always kept, use @opts to also keep the owner and mtime
+//
+// unlike RepFileFunc, this method returns the number of replacements, and only returns an error if something failed
+// (if there is no match, the file is not touched)
+//
+// @all: if true, will replace all text matching @re,
+// if false, will only replace the first occurrence
+func (reg *RegexpRE2) RepFileFuncAtomic(path string, rep func(data func(int) []byte) []byte, all bool, opts ...FileOptions) (int, error) {
+	return repFileAtomic(context.Background(), reg, reg.len, path, all, opts, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+//* shared atomic file methods
+
+// repFileAtomic replaces the matches in a file with the result of @rep, and renames the result over the file
+//
+// the context is checked between chunks, and the file is only touched after the result is complete
+func repFileAtomic(ctx context.Context, reg matcher, reLen int64, path string, all bool, opts []FileOptions, rep func(m *Match) []byte) (int, error) {
+	var o FileOptions
+	if len(opts) != 0 {
+		o = opts[0]
+	}
+
+	// replace the target of a symlink, not the symlink itself
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return 0, err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".goregex-*")
+	if err != nil {
+		return 0, err
+	}
+	done := false
+	defer func() {
+		if !done {
+			// closing twice is fine, the error is ignored
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	n := -1
+	if !all {
+		n = 1
+	}
+
+	w := bufio.NewWriter(tmp)
+	count, err := repStream(ctx, reg, w, src, int(fileWindow(reLen, []int64{o.MaxReSize})), n, rep)
+	if err != nil {
+		return 0, err
+	} else if count == 0 {
+		return 0, nil
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+
+	if j := journalFor(o.Journal); j != nil {
+		if err := j.backup(src); err != nil {
+			return 0, err
+		}
+	}
+
+	// the owner is set first, since chown clears the setuid and setgid bits
+	if o.KeepOwner {
+		if err := chownLike(tmp, info); err != nil {
+			return 0, err
+		}
+	}
+	if err := tmp.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+		return 0, err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+
+	if o.KeepModTime {
+		if err := os.Chtimes(tmp.Name(), time.Time{}, info.ModTime()); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+	done = true
+
+	// sync the directory, so the rename itself survives a crash
+	return count, syncDir(filepath.Dir(path))
+}
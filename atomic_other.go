@@ -0,0 +1,15 @@
+//go:build !unix
+
+package regex
+
+import "os"
+
+// chownLike does nothing, since file owners are not supported on this OS
+func chownLike(file *os.File, info os.FileInfo) error {
+	return nil
+}
+
+// syncDir does nothing, since directories cannot be synced on this OS
+func syncDir(dir string) error {
+	return nil
+}
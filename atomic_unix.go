@@ -0,0 +1,27 @@
+//go:build unix
+
+package regex
+
+import (
+	"os"
+	"syscall"
+)
+
+// chownLike sets the owner of @file to the owner in @info
+func chownLike(file *os.File, info os.FileInfo) error {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return file.Chown(int(st.Uid), int(st.Gid))
+}
+
+// syncDir syncs a directory to disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,178 @@
+package regex
+
+import (
+	"expvar"
+	"reflect"
+	"regexp"
+	"regexp/syntax"
+	"unsafe"
+
+	"github.com/GRbit/go-pcre"
+	"github.com/tkdeng/goregex/common"
+)
+
+// CacheOptions sets the limits of the compile caches
+//
+// PCRE and RE2 regex are cached separately, and each cache has its own limits
+// when a limit is reached, the least recently used regex are removed first
+type CacheOptions struct {
+	// MaxEntries is the max number of regex in each cache (0 for no limit)
+	MaxEntries int
+
+	// MaxBytes is the max memory used by the compiled regex in each cache (0 for no limit)
+	//
+	// the size of a PCRE regex is the compiled pattern size PCRE reports,
+	// and the size of an RE2 regex is an estimate from its compiled program
+	MaxBytes int64
+
+	// OnEvict is called with the cache key of every regex removed from a cache
+	//
+	// @reg is nil if the regex failed to compile (compile errors are cached too)
+	//
+	// note: a removed regex can still be used, it just has to be compiled again by the next Comp call
+	OnEvict func(key string, reg Engine)
+}
+
+// CacheStats has the counters of every compile cache
+type CacheStats struct {
+	PCRE common.CacheStats
+	RE2  common.CacheStats
+
+	// Preprocessor is the cache of the expanded patterns (params, [] groups, etc.), before they are compiled by PCRE or RE2
+	Preprocessor common.CacheStats
+}
+
+// CacheSnapshot has every item in each compile cache, with the most recently used item first
+type CacheSnapshot struct {
+	PCRE         []common.CacheEntry
+	RE2          []common.CacheEntry
+	Preprocessor []common.CacheEntry
+}
+
+func init() {
+	// the stats can be read from /debug/vars, if the default http mux is served
+	expvar.Publish("goregex", expvar.Func(func() any {
+		return Stats()
+	}))
+}
+
+// Stats returns the hits, misses, compile errors, evictions, entry counts and total compile time of the compile caches
+//
+// the stats are also published with expvar as "goregex"
+func Stats() CacheStats {
+	return CacheStats{
+		PCRE:         cache.Stats(),
+		RE2:          cacheRE2.Stats(),
+		Preprocessor: compCache.Stats(),
+	}
+}
+
+// Snapshot lists the cached patterns with their last use time and hit count (ie: for a debug endpoint)
+//
+// the keys of regex compiled with options start with the options (see CompWith)
+func Snapshot() CacheSnapshot {
+	return CacheSnapshot{
+		PCRE:         cache.Snapshot(),
+		RE2:          cacheRE2.Snapshot(),
+		Preprocessor: compCache.Snapshot(),
+	}
+}
+
+// SetCacheOptions sets the limits of the compile caches, and removes regex until the caches fit in the new limits
+//
+// the caches have no limits by default, and only remove regex that have not been used in a while
+func SetCacheOptions(opts CacheOptions) {
+	cache.SetOptions(common.CacheOptions[*Regexp]{
+		MaxEntries: opts.MaxEntries,
+		MaxBytes:   opts.MaxBytes,
+		Size: func(reg *Regexp) int64 {
+			return reg.memSize()
+		},
+		OnEvict: func(key string, reg *Regexp, err error) {
+			if opts.OnEvict == nil {
+				return
+			}
+			if reg == nil {
+				opts.OnEvict(key, nil)
+				return
+			}
+			opts.OnEvict(key, reg)
+		},
+	})
+
+	cacheRE2.SetOptions(common.CacheOptions[*RegexpRE2]{
+		MaxEntries: opts.MaxEntries,
+		MaxBytes:   opts.MaxBytes,
+		Size: func(reg *RegexpRE2) int64 {
+			return reg.memSize()
+		},
+		OnEvict: func(key string, reg *RegexpRE2, err error) {
+			if opts.OnEvict == nil {
+				return
+			}
+			if reg == nil {
+				opts.OnEvict(key, nil)
+				return
+			}
+			opts.OnEvict(key, reg)
+		},
+	})
+
+	// the expanded patterns are only a step before the regex caches, so they get the same limits
+	compCache.SetOptions(common.CacheOptions[[]byte]{
+		MaxEntries: opts.MaxEntries,
+		MaxBytes:   opts.MaxBytes,
+		Size: func(b []byte) int64 {
+			return int64(len(b))
+		},
+	})
+}
+
+// memSize returns the memory used by a compiled PCRE regex
+//
+// note: go-pcre does not expose the compiled pattern, so its size is read from the unexported field
+// (the same size that pcre_fullinfo reports with PCRE_INFO_SIZE)
+//
+// the JIT copy is counted once it is compiled (see compJIT)
+func (reg *Regexp) memSize() int64 {
+	size := pcreSize(&reg.RE) + int64(len(reg.expr))
+	if jit := reg.jit.Load(); jit != nil {
+		size += pcreSize(jit)
+	}
+	return size
+}
+
+// pcreSize returns the size of a compiled go-pcre pattern
+func pcreSize(re *pcre.Regexp) int64 {
+	ptr := reflect.ValueOf(re).Elem().FieldByName("ptr")
+	if !ptr.IsValid() {
+		return 0
+	}
+	return int64(ptr.Len())
+}
+
+// memSize returns an estimate of the memory used by a compiled RE2 regex (see re2Size)
+func (reg *RegexpRE2) memSize() int64 {
+	return reg.size
+}
+
+// re2Size returns an estimate of the memory used by a compiled RE2 regex
+//
+// the regexp package does not report its size, so the regex is compiled again to count the instructions of its program
+//
+// this is only run once when the regex is compiled, and the result is kept for the cache limits
+func re2Size(reg *regexp.Regexp) int64 {
+	expr := reg.String()
+	size := int64(len(expr))
+
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return size
+	}
+	prog, err := syntax.Compile(re.Simplify())
+	if err != nil {
+		return size
+	}
+
+	return size + int64(len(prog.Inst))*int64(unsafe.Sizeof(syntax.Inst{}))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	regex "github.com/tkdeng/goregex"
+)
+
+const (
+	colorPath  = "\x1b[35m"
+	colorLine  = "\x1b[32m"
+	colorMatch = "\x1b[1;31m"
+	colorSep   = "\x1b[36m"
+	colorReset = "\x1b[0m"
+
+	colorDiffHeader = "\x1b[1m"
+	colorDiffHunk   = "\x1b[36m"
+	colorDiffDel    = "\x1b[31m"
+	colorDiffAdd    = "\x1b[32m"
+)
+
+// grep prints every line with a match, with its path, line and column, and the matches highlighted
+//
+//	goregex grep [flags] pattern [path...]
+func grep(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var c common
+	var contextLines int
+
+	fs := flag.NewFlagSet("grep", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, "usage: goregex grep [flags] pattern [path...]\n\nprints the path, line, column and text of every line with a match\n\n")
+		fs.PrintDefaults()
+	}
+	c.flags(fs)
+	fs.IntVar(&contextLines, "C", 0, "print `n` lines of context before and after each match")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return 2
+	}
+
+	reg, err := c.comp(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, "goregex:", err)
+		return 2
+	}
+
+	p := &printer{out: stdout, color: c.useColor(stdout), context: contextLines > 0}
+	paths := fs.Args()[1:]
+
+	if len(paths) == 0 {
+		res, err := reg.FindAllReader(stdin, contextLines)
+		if err != nil {
+			fmt.Fprintln(stderr, "goregex:", err)
+			return 2
+		}
+		p.print("", res)
+		return p.exitCode(false)
+	}
+
+	p.paths = len(paths) > 1 || c.recursive
+	failed := false
+	for _, path := range paths {
+		if err := c.checkPath(path); err != nil {
+			fmt.Fprintln(stderr, "goregex:", err)
+			failed = true
+			continue
+		}
+
+		results, err := reg.FindAllDir(path, contextLines, c.walkOptions())
+		if err != nil {
+			fmt.Fprintln(stderr, "goregex:", err)
+			failed = true
+			continue
+		}
+
+		for _, res := range results {
+			if res.Err != nil {
+				fmt.Fprintln(stderr, "goregex:", res.Err)
+				failed = true
+				continue
+			}
+			p.print(res.Path, res.Matches)
+		}
+	}
+
+	return p.exitCode(failed)
+}
+
+// printer prints matches in a similar format to grep
+type printer struct {
+	out     io.Writer
+	color   bool
+	paths   bool
+	context bool
+	found   bool
+}
+
+// exitCode returns 0 if a match was found, 1 if not, and 2 if something failed
+func (p *printer) exitCode(failed bool) int {
+	if failed {
+		return 2
+	} else if p.found {
+		return 0
+	}
+	return 1
+}
+
+// paint colors a string if color is enabled
+func (p *printer) paint(color string, s string) string {
+	if !p.color || s == "" {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// prefix returns the path and line number at the start of a line
+//
+// @sep is ":" for a match, and "-" for a context line (the same as grep)
+func (p *printer) prefix(path string, line int, sep string) string {
+	res := ""
+	if p.paths {
+		res += p.paint(colorPath, path) + p.paint(colorSep, sep)
+	}
+	return res + p.paint(colorLine, strconv.Itoa(line)) + p.paint(colorSep, sep)
+}
+
+// print prints the lines of the matches in a file, with every match on them highlighted
+//
+// the matches that start on a line that was already printed are printed with that line
+func (p *printer) print(path string, matches []*regex.FileMatch) {
+	for i := 0; i < len(matches); {
+		m := matches[i]
+		if p.context && p.found {
+			fmt.Fprintln(p.out, p.paint(colorSep, "--"))
+		}
+		p.found = true
+
+		line := m.Line - len(m.Before)
+		for _, b := range m.Before {
+			fmt.Fprintf(p.out, "%s%s\n", p.prefix(path, line, "-"), b)
+			line++
+		}
+
+		// start is the offset of the first line in the file
+		start := m.Offset - int64(m.Column-1)
+		text := m.Text
+		after := m.After
+		group := []*regex.FileMatch{}
+		for ; i < len(matches); i++ {
+			n := matches[i]
+			nStart := n.Offset - int64(n.Column-1)
+			if nStart > start+int64(len(text)) {
+				break
+			}
+			if end := nStart + int64(len(n.Text)); end > start+int64(len(text)) {
+				text = append(text[:len(text):len(text)], n.Text[start+int64(len(text))-nStart:]...)
+				after = n.After
+			}
+			group = append(group, n)
+		}
+
+		line = m.Line
+		pos := 0
+		for j, l := range bytes.Split(text, []byte("\n")) {
+			col := ""
+			if j == 0 {
+				col = p.paint(colorLine, strconv.Itoa(m.Column)) + p.paint(colorSep, ":")
+			}
+			fmt.Fprintf(p.out, "%s%s%s\n", p.prefix(path, line, ":"), col, p.highlight(l, start+int64(pos), group))
+			pos += len(l) + 1
+			line++
+		}
+
+		for _, a := range after {
+			fmt.Fprintf(p.out, "%s%s\n", p.prefix(path, line, "-"), a)
+			line++
+		}
+	}
+}
+
+// highlight colors the parts of a line that are in a match
+//
+// @offset: the offset of the line in the file
+func (p *printer) highlight(line []byte, offset int64, matches []*regex.FileMatch) string {
+	res := ""
+	pos := 0
+	for _, m := range matches {
+		from := min(max(int(m.Offset-offset), pos), len(line))
+		to := min(max(int(m.Offset-offset)+len(m.Bytes()), from), len(line))
+		res += string(line[pos:from]) + p.paint(colorMatch, string(line[from:to]))
+		pos = to
+	}
+	return res + string(line[pos:])
+}
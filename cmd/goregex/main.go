@@ -0,0 +1,155 @@
+// goregex is a command line tool to search and replace with the goregex pattern dialect
+//
+//	goregex grep [flags] pattern [path...]
+//	goregex replace [flags] pattern replacement [path...]
+//
+// with no path, stdin is used
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	regex "github.com/tkdeng/goregex"
+)
+
+const usage = `usage:
+  goregex grep [flags] pattern [path...]
+  goregex replace [flags] pattern replacement [path...]
+
+with no path, stdin is used
+
+run "goregex grep -h" or "goregex replace -h" for the flags of each command
+`
+
+// pattern is the part of *regex.Regexp and *regex.RegexpRE2 used by the commands
+type pattern interface {
+	FindAllReader(r io.Reader, contextLines int, maxReSize ...int64) ([]*regex.FileMatch, error)
+	FindAllDir(root string, contextLines int, opts ...regex.WalkOptions) ([]*regex.DirResult, error)
+	RepStrStream(dst io.Writer, src io.Reader, rep []byte, maxReSize ...int64) (int, error)
+	RepDirStr(root string, rep []byte, opts ...regex.WalkOptions) ([]*regex.DirResult, error)
+	RepStrDryRun(str []byte, rep []byte) *regex.DryRun
+	RepFileStrDryRun(file *os.File, rep []byte, all bool, maxReSize ...int64) (*regex.DryRun, error)
+}
+
+// listFlag is a flag that can be used more than once
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(val string) error {
+	*l = append(*l, val)
+	return nil
+}
+
+// common has the flags shared by every command
+type common struct {
+	engine    string
+	caseless  bool
+	recursive bool
+	color     string
+	params    listFlag
+	include   listFlag
+	exclude   listFlag
+	binary    bool
+	noIgnore  bool
+}
+
+func (c *common) flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.engine, "engine", "pcre", "the regex engine to use (pcre or re2)")
+	fs.BoolVar(&c.caseless, "i", false, "ignore case")
+	fs.BoolVar(&c.recursive, "r", false, "search directories recursively")
+	fs.StringVar(&c.color, "color", "auto", "color the output (auto, always or never)")
+	fs.Var(&c.params, "p", "a param for %1, %2, etc. in the pattern (can be used more than once)")
+	fs.Var(&c.include, "include", "only visit files that match a glob (can be used more than once)")
+	fs.Var(&c.exclude, "exclude", "skip files and directories that match a glob (can be used more than once)")
+	fs.BoolVar(&c.binary, "binary", false, "also visit binary files")
+	fs.BoolVar(&c.noIgnore, "no-gitignore", false, "do not read .gitignore files")
+}
+
+// comp compiles a pattern with the selected engine
+func (c *common) comp(re string) (pattern, error) {
+	opts := regex.Options{Caseless: c.caseless}
+
+	switch c.engine {
+	case "pcre":
+		return regex.CompTryWith(opts, re, c.params...)
+	case "re2":
+		return regex.CompTryWithRE2(opts, re, c.params...)
+	}
+	return nil, fmt.Errorf("%w: %s", regex.ErrUnknownEngine, c.engine)
+}
+
+// walkOptions returns the options for the Dir methods
+func (c *common) walkOptions() regex.WalkOptions {
+	return regex.WalkOptions{
+		Include:     c.include,
+		Exclude:     c.exclude,
+		Binary:      c.binary,
+		NoGitignore: c.noIgnore,
+	}
+}
+
+// checkPath returns an error if a path is a directory and -r was not used
+func (c *common) checkPath(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && !c.recursive {
+		return fmt.Errorf("%s: is a directory (use -r)", path)
+	}
+	return nil
+}
+
+// useColor returns true if the output should be colored
+func (c *common) useColor(out io.Writer) bool {
+	switch c.color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	if f, ok := out.(*os.File); ok {
+		if info, err := f.Stat(); err == nil {
+			return info.Mode()&os.ModeCharDevice != 0
+		}
+	}
+	return false
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs a command, and returns the exit code
+//
+// grep returns 1 if there was no match, and every command returns 2 on an error
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "grep":
+		return grep(args[1:], stdin, stdout, stderr)
+	case "replace":
+		return replace(args[1:], stdin, stdout, stderr)
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "goregex: unknown command %q\n\n%s", args[0], usage)
+	return 2
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGrep(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/a.txt", []byte("one\nkey=1\ntwo\n"), 0644)
+	os.WriteFile(dir+"/b.txt", []byte("key=2"), 0644)
+
+	var check = func(args []string, stdin string, code int, e string) {
+		var stdout, stderr bytes.Buffer
+		if c := run(args, strings.NewReader(stdin), &stdout, &stderr); c != code {
+			t.Error("[", args, c, stderr.String(), "]\n", errors.New("exit code does not match expected code"))
+		}
+		if r := strings.ReplaceAll(stdout.String(), dir+"/", ""); r != e {
+			t.Error("[", r, "]\n", errors.New("result does not match expected result: "+e))
+		}
+	}
+
+	for _, engine := range []string{"pcre", "re2"} {
+		check([]string{"grep", "-engine", engine, `key=(\d)`}, "a\nb key=1", 0, "2:3:b key=1\n")
+		check([]string{"grep", "-engine", engine, `key=(\d)`}, "a key=1 key=2\nkey=3", 0, "1:3:a key=1 key=2\n2:1:key=3\n")
+		check([]string{"grep", "-engine", engine, `1\nk`}, "a key=1\nkey=2\nb", 0, "1:7:a key=1\n2:key=2\n")
+		check([]string{"grep", "-engine", engine, `KEY`}, "a\nb key=1", 1, "")
+		check([]string{"grep", "-engine", engine, "-i", `KEY`}, "key", 0, "1:1:key\n")
+		check([]string{"grep", "-engine", engine, "-C", "1", `key`}, "one\nkey=1\ntwo\nthree", 0, "1-one\n2:1:key=1\n3-two\n")
+		check([]string{"grep", "-engine", engine, "-r", `key=\d`, dir}, "", 0, "a.txt:2:1:key=1\nb.txt:1:1:key=2\n")
+		check([]string{"grep", "-engine", engine, "-p", "2", `key=%1`, dir + "/b.txt"}, "", 0, "1:1:key=2\n")
+	}
+
+	check([]string{"grep", "-color", "always", `key`}, "a key=1", 0, "\x1b[32m1\x1b[0m\x1b[36m:\x1b[0m\x1b[32m3\x1b[0m\x1b[36m:\x1b[0ma \x1b[1;31mkey\x1b[0m=1\n")
+	check([]string{"grep", `key`, dir}, "", 2, "")
+	check([]string{"grep", "-engine", "none", `key`}, "", 2, "")
+	check([]string{"unknown"}, "", 2, "")
+}
+
+func TestReplace(t *testing.T) {
+	dir := t.TempDir()
+
+	var check = func(args []string, stdin string, code int, e string) {
+		var stdout, stderr bytes.Buffer
+		if c := run(args, strings.NewReader(stdin), &stdout, &stderr); c != code {
+			t.Error("[", args, c, stderr.String(), "]\n", errors.New("exit code does not match expected code"))
+		}
+		if r := strings.ReplaceAll(stdout.String(), dir+"/", ""); r != e {
+			t.Error("[", r, "]\n", errors.New("result does not match expected result: "+e))
+		}
+	}
+
+	for _, engine := range []string{"pcre", "re2"} {
+		os.WriteFile(dir+"/a.txt", []byte("key=1\nkey=2"), 0644)
+		os.WriteFile(dir+"/b.txt", []byte("none"), 0644)
+
+		check([]string{"replace", "-engine", engine, `key=(\d)`, "val=$1"}, "a key=1", 0, "a val=1")
+		check([]string{"replace", "-engine", engine, "-dry-run", `key=(\d)`, "val=$1"}, "key=1 key=2", 0, "-: 2 replacements\n")
+		check([]string{"replace", "-engine", engine, `key=(\d)`, "val=$1", dir + "/a.txt"}, "", 0, "val=1\nval=2")
+		check([]string{"replace", "-engine", engine, "-r", "-dry-run", `key=(\d)`, "val=$1", dir}, "", 0, "a.txt: 2 replacements\n")
+
+		check([]string{"replace", "-engine", engine, "-diff", `key=(\d)`, "val=$1"}, "a\nkey=1\n", 0, "--- -\n+++ -\n@@ -1,2 +1,2 @@\n a\n-key=1\n+val=1\n")
+		check([]string{"replace", "-engine", engine, "-diff", `key=\d\n`, ""}, "a key=1\nb key=2\nc\n", 0, "--- -\n+++ -\n@@ -1,3 +1,1 @@\n-a key=1\n-b key=2\n-c\n+a b c\n")
+		check([]string{"replace", "-engine", engine, "-r", "-diff", `key=(\d)`, "val=$1", dir}, "", 0, "--- a.txt\n+++ a.txt\n@@ -1,2 +1,2 @@\n-key=1\n-key=2\n\\ No newline at end of file\n+val=1\n+val=2\n\\ No newline at end of file\n")
+
+		check([]string{"replace", "-engine", engine, "-r", "-in-place", `key=(\d)`, "val=$1", dir}, "", 0, "")
+		if b, _ := os.ReadFile(dir + "/a.txt"); string(b) != "val=1\nval=2" {
+			t.Error("[", string(b), "]\n", errors.New("file result does not match expected result"))
+		}
+	}
+
+	check([]string{"replace", "-color", "always", "-diff", `key=(\d)`, "val=$1"}, "a\nkey=1\n", 0,
+		"\x1b[1m--- -\x1b[0m\n\x1b[1m+++ -\x1b[0m\n\x1b[36m@@ -1,2 +1,2 @@\x1b[0m\n a\n\x1b[31m-key=1\x1b[0m\n\x1b[32m+val=1\x1b[0m\n")
+	check([]string{"replace", "-r", `key`, "val", dir}, "", 2, "")
+	check([]string{"replace", "-in-place", `key`, "val"}, "", 2, "")
+	check([]string{"replace", "-in-place", "-dry-run", `key`, "val", dir}, "", 2, "")
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// replace replaces every match, and prints the result or edits the files in place
+//
+//	goregex replace [flags] pattern replacement [path...]
+func replace(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var c common
+	var inPlace, dryRun, diff bool
+
+	fs := flag.NewFlagSet("replace", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, "usage: goregex replace [flags] pattern replacement [path...]\n\n"+
+			"replaces every match (use $1, ${12} or ${name} for capture groups)\n"+
+			"and prints the result, unless -in-place, -dry-run or -diff is used\n\n")
+		fs.PrintDefaults()
+	}
+	c.flags(fs)
+	fs.BoolVar(&inPlace, "in-place", false, "edit the files in place (each file is replaced atomically)")
+	fs.BoolVar(&dryRun, "dry-run", false, "only print the number of replacements in each file")
+	fs.BoolVar(&diff, "diff", false, "only print a unified diff of the replacements")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return 2
+	}
+	if (inPlace && dryRun) || (inPlace && diff) || (dryRun && diff) {
+		fmt.Fprintln(stderr, "goregex: only one of -in-place, -dry-run and -diff can be used")
+		return 2
+	}
+
+	reg, err := c.comp(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, "goregex:", err)
+		return 2
+	}
+	rep := []byte(fs.Arg(1))
+	paths := fs.Args()[2:]
+
+	if len(paths) == 0 {
+		if inPlace {
+			fmt.Fprintln(stderr, "goregex: -in-place needs a path")
+			return 2
+		}
+
+		if diff {
+			str, err := io.ReadAll(stdin)
+			if err != nil {
+				fmt.Fprintln(stderr, "goregex:", err)
+				return 2
+			}
+			if err := reg.RepStrDryRun(str, rep).WriteDiff(diffOut(stdout, c.useColor(stdout)), "-", 3); err != nil {
+				fmt.Fprintln(stderr, "goregex:", err)
+				return 2
+			}
+			return 0
+		}
+
+		if dryRun {
+			count, err := reg.RepStrStream(io.Discard, stdin, rep)
+			if err != nil {
+				fmt.Fprintln(stderr, "goregex:", err)
+				return 2
+			}
+			fmt.Fprintf(stdout, "-: %d replacements\n", count)
+			return 0
+		}
+
+		if _, err := reg.RepStrStream(stdout, stdin, rep); err != nil {
+			fmt.Fprintln(stderr, "goregex:", err)
+			return 2
+		}
+		return 0
+	}
+
+	failed := false
+	for _, path := range paths {
+		if err := c.checkPath(path); err != nil {
+			fmt.Fprintln(stderr, "goregex:", err)
+			failed = true
+			continue
+		}
+
+		switch {
+		case inPlace:
+			results, err := reg.RepDirStr(path, rep, c.walkOptions())
+			if err != nil {
+				fmt.Fprintln(stderr, "goregex:", err)
+				failed = true
+			}
+			for _, res := range results {
+				if res.Err != nil {
+					fmt.Fprintln(stderr, "goregex:", res.Err)
+					failed = true
+				}
+			}
+
+		case dryRun:
+			// every match is replaced, so the number of matches is the number of replacements
+			results, err := reg.FindAllDir(path, 0, c.walkOptions())
+			if err != nil {
+				fmt.Fprintln(stderr, "goregex:", err)
+				failed = true
+			}
+			for _, res := range results {
+				if res.Err != nil {
+					fmt.Fprintln(stderr, "goregex:", res.Err)
+					failed = true
+					continue
+				}
+				fmt.Fprintf(stdout, "%s: %d replacements\n", res.Path, res.Count)
+			}
+
+		case diff:
+			out := diffOut(stdout, c.useColor(stdout))
+
+			// only the files with a match are read again for the diff
+			results, err := reg.FindAllDir(path, 0, c.walkOptions())
+			if err != nil {
+				fmt.Fprintln(stderr, "goregex:", err)
+				failed = true
+			}
+			for _, res := range results {
+				if res.Err == nil {
+					res.Err = writeDiff(reg, out, res.Path, rep)
+				}
+				if res.Err != nil {
+					fmt.Fprintln(stderr, "goregex:", res.Err)
+					failed = true
+				}
+			}
+
+		default:
+			if c.recursive {
+				fmt.Fprintln(stderr, "goregex: -r needs -in-place, -dry-run or -diff")
+				return 2
+			}
+
+			file, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintln(stderr, "goregex:", err)
+				failed = true
+				continue
+			}
+			_, err = reg.RepStrStream(stdout, file, rep)
+			file.Close()
+			if err != nil {
+				fmt.Fprintln(stderr, "goregex:", err)
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return 2
+	}
+	return 0
+}
+
+// writeDiff writes a unified diff of the replacements in a file
+func writeDiff(reg pattern, out io.Writer, path string, rep []byte) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dry, err := reg.RepFileStrDryRun(file, rep, true)
+	if err != nil {
+		return err
+	}
+	return dry.WriteDiff(out, path, 3)
+}
+
+// diffOut returns a writer that colors the lines of a unified diff, or @out if color is disabled
+func diffOut(out io.Writer, color bool) io.Writer {
+	if !color {
+		return out
+	}
+	return &diffColor{out: out}
+}
+
+// diffColor colors each line of a unified diff by its first chars
+//
+// a line is only written once it is complete, and WriteDiff always ends with a newline, so nothing is left in @partial
+type diffColor struct {
+	out     io.Writer
+	partial []byte
+}
+
+func (d *diffColor) Write(b []byte) (int, error) {
+	res := []byte{}
+
+	d.partial = append(d.partial, b...)
+	for {
+		i := bytes.IndexByte(d.partial, '\n')
+		if i == -1 {
+			break
+		}
+		line := d.partial[:i]
+		d.partial = d.partial[i+1:]
+
+		color := ""
+		switch {
+		case bytes.HasPrefix(line, []byte("--- ")), bytes.HasPrefix(line, []byte("+++ ")):
+			color = colorDiffHeader
+		case bytes.HasPrefix(line, []byte("@@")):
+			color = colorDiffHunk
+		case bytes.HasPrefix(line, []byte("-")):
+			color = colorDiffDel
+		case bytes.HasPrefix(line, []byte("+")):
+			color = colorDiffAdd
+		}
+
+		if color != "" {
+			res = append(res, color...)
+			res = append(res, line...)
+			res = append(res, colorReset...)
+		} else {
+			res = append(res, line...)
+		}
+		res = append(res, '\n')
+	}
+
+	if _, err := d.out.Write(res); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"container/list"
+	"sort"
 	"sync"
 	"time"
 )
@@ -11,6 +13,85 @@ type CacheMap[T any] struct {
 	lastUse map[string]time.Time
 	mu sync.Mutex
 	null T
+
+	// lru has the keys in order of use, with the most recently used key at the front
+	lru *list.List
+	elem map[string]*list.Element
+	size map[string]int64
+	bytes int64
+	opts CacheOptions[T]
+
+	// stats
+	hits map[string]uint64
+	stats CacheStats
+
+	// now returns the current time (default: time.Now)
+	now func() time.Time
+}
+
+// CacheStats has the counters of a cache
+type CacheStats struct {
+	// Hits is the number of Get calls that found an item (including cached errors)
+	Hits uint64
+
+	// Misses is the number of Get calls that did not find an item
+	Misses uint64
+
+	// Errors is the number of items that were set with an error
+	Errors uint64
+
+	// Evictions is the number of items that were removed by a limit or by DelOld
+	Evictions uint64
+
+	// Entries is the number of items in the cache
+	Entries int
+
+	// Bytes is the total size of the items in the cache (0 without a Size func)
+	Bytes int64
+
+	// CompileTime is the total time added by AddCompileTime
+	CompileTime time.Duration
+}
+
+// CacheEntry is an item of a cache snapshot
+type CacheEntry struct {
+	Key string
+	LastUse time.Time
+	Hits uint64
+	Size int64
+
+	// Err is the error of the item, if it was set with an error
+	Err string
+}
+
+// CacheOptions sets the limits of a cache
+//
+// when a limit is reached, the least recently used items are removed first
+type CacheOptions[T any] struct {
+	// MaxEntries is the max number of items in the cache (0 for no limit)
+	MaxEntries int
+
+	// MaxBytes is the max total size of the items in the cache (0 for no limit)
+	//
+	// this needs a Size func
+	MaxBytes int64
+
+	// Size returns the size of a value in bytes
+	//
+	// items with an error have a size of 0
+	Size func(value T) int64
+
+	// OnEvict is called for every item that is removed from the cache by a limit or by DelOld
+	//
+	// it is called after the cache is unlocked, so it is safe to use the cache from it
+	OnEvict func(key string, value T, err error)
+}
+
+// cacheItem is an item that was removed from the cache, for OnEvict
+type cacheItem[T any] struct {
+	key string
+	value T
+	err error
 }
 
 func NewCache[T any]() CacheMap[T] {
@@ -18,9 +99,31 @@ func NewCache[T any]() CacheMap[T] {
 		value: map[string]T{},
 		err: map[string]error{},
 		lastUse: map[string]time.Time{},
+		lru: list.New(),
+		elem: map[string]*list.Element{},
+		size: map[string]int64{},
+		hits: map[string]uint64{},
 	}
 }
 
+// SetOptions sets the limits of the cache, and removes items until the cache fits in the new limits
+func (cache *CacheMap[T]) SetOptions(opts CacheOptions[T]) {
+	cache.mu.Lock()
+	cache.opts = opts
+
+	// the old sizes may have been measured by a different Size func
+	cache.bytes = 0
+	for key, val := range cache.value {
+		cache.size[key] = cache.sizeOf(val)
+		cache.bytes += cache.size[key]
+	}
+
+	evicted := cache.evict("")
+	cache.mu.Unlock()
+
+	cache.onEvict(evicted)
+}
+
 // get returns a value or an error if it exists
 //
 // if the object key does not exist, it will return both a nil/zero value (of the relevant type) and nil error
@@ -29,53 +132,274 @@ func (cache *CacheMap[T]) Get(key string) (T, error) {
 	defer cache.mu.Unlock()
 
 	if err, ok := cache.err[key]; ok {
-		cache.lastUse[key] = time.Now()
+		cache.use(key)
+		cache.hit(key)
 		return cache.null, err
 	}else if val, ok := cache.value[key]; ok {
-		cache.lastUse[key] = time.Now()
+		cache.use(key)
+		cache.hit(key)
 		return val, nil
 	}
 
+	cache.stats.Misses++
 	return cache.null, nil
 }
 
+// Peek returns a value or an error like Get, without marking it as used or counting it in the stats
+func (cache *CacheMap[T]) Peek(key string) (T, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if err, ok := cache.err[key]; ok {
+		return cache.null, err
+	}
+	return cache.value[key], nil
+}
+
 // set sets or adds a new key with either a value, or an error
+//
+// if the cache is over its limits after this, the least recently used items are removed
 func (cache *CacheMap[T]) Set(key string, value T, err error) {
 	cache.mu.Lock()
-	defer cache.mu.Unlock()
 
+	cache.bytes -= cache.size[key]
 	if err != nil {
 		cache.err[key] = err
 		delete(cache.value, key)
-		cache.lastUse[key] = time.Now()
+		cache.size[key] = 0
+		cache.stats.Errors++
 	}else{
 		cache.value[key] = value
 		delete(cache.err, key)
-		cache.lastUse[key] = time.Now()
+		cache.size[key] = cache.sizeOf(value)
 	}
+	cache.bytes += cache.size[key]
+	cache.use(key)
+
+	evicted := cache.evict(key)
+	cache.mu.Unlock()
+
+	cache.onEvict(evicted)
+}
+
+// Resize measures the size of a value again, after the value has grown (ie: a regex that was also compiled with JIT)
+//
+// if the cache is over its limits after this, the least recently used items are removed
+func (cache *CacheMap[T]) Resize(key string) {
+	cache.mu.Lock()
+
+	val, ok := cache.value[key]
+	if !ok {
+		cache.mu.Unlock()
+		return
+	}
+
+	cache.bytes -= cache.size[key]
+	cache.size[key] = cache.sizeOf(val)
+	cache.bytes += cache.size[key]
+
+	evicted := cache.evict(key)
+	cache.mu.Unlock()
+
+	cache.onEvict(evicted)
 }
 
 // delOld removes old cache items
 func (cache *CacheMap[T]) DelOld(cacheTime time.Duration){
 	cache.mu.Lock()
-	defer cache.mu.Unlock()
+
+	evicted := []cacheItem[T]{}
 
 	if cacheTime == 0 {
 		for key := range cache.lastUse {
-			delete(cache.value, key)
-			delete(cache.err, key)
-			delete(cache.lastUse, key)
+			evicted = append(evicted, cache.del(key))
+		}
+	}else{
+		now := cache.clock().UnixNano()
+
+		for key, lastUse := range cache.lastUse {
+			if now - lastUse.UnixNano() > int64(cacheTime) {
+				evicted = append(evicted, cache.del(key))
+			}
 		}
-		return
 	}
 
-	now := time.Now().UnixNano()
+	cache.mu.Unlock()
+
+	cache.onEvict(evicted)
+}
+
+// Len returns the number of items in the cache, and their total size in bytes
+func (cache *CacheMap[T]) Len() (int, int64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return len(cache.lastUse), cache.bytes
+}
 
+// SetClock sets the func used to get the current time, for the last use time of the items and DelOld
+//
+// @now: nil uses time.Now
+func (cache *CacheMap[T]) SetClock(now func() time.Time) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.now = now
+}
+
+// clock returns the current time
+//
+// the cache must be locked
+func (cache *CacheMap[T]) clock() time.Time {
+	if cache.now == nil {
+		return time.Now()
+	}
+	return cache.now()
+}
+
+// AddCompileTime adds the time it took to make a value to the stats of the cache
+func (cache *CacheMap[T]) AddCompileTime(d time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.stats.CompileTime += d
+}
+
+// Stats returns the counters of the cache
+func (cache *CacheMap[T]) Stats() CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	stats := cache.stats
+	stats.Entries = len(cache.lastUse)
+	stats.Bytes = cache.bytes
+	return stats
+}
+
+// Snapshot returns every item in the cache, with the most recently used item first
+func (cache *CacheMap[T]) Snapshot() []CacheEntry {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	res := make([]CacheEntry, 0, len(cache.lastUse))
 	for key, lastUse := range cache.lastUse {
-		if now - lastUse.UnixNano() > int64(cacheTime) {
-			delete(cache.value, key)
-			delete(cache.err, key)
-			delete(cache.lastUse, key)
+		entry := CacheEntry{
+			Key: key,
+			LastUse: lastUse,
+			Hits: cache.hits[key],
+			Size: cache.size[key],
+		}
+		if err := cache.err[key]; err != nil {
+			entry.Err = err.Error()
+		}
+		res = append(res, entry)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].LastUse.Equal(res[j].LastUse) {
+			return res[i].LastUse.After(res[j].LastUse)
+		}
+		return res[i].Key < res[j].Key
+	})
+
+	return res
+}
+
+// hit counts a Get call that found an item
+//
+// the cache must be locked
+func (cache *CacheMap[T]) hit(key string) {
+	cache.stats.Hits++
+	cache.hits[key]++
+}
+
+// use marks a key as the most recently used item
+//
+// the cache must be locked
+func (cache *CacheMap[T]) use(key string) {
+	cache.lastUse[key] = cache.clock()
+
+	if e, ok := cache.elem[key]; ok {
+		cache.lru.MoveToFront(e)
+	}else{
+		cache.elem[key] = cache.lru.PushFront(key)
+	}
+}
+
+// del removes a key from the cache, and returns the removed item
+//
+// the cache must be locked
+func (cache *CacheMap[T]) del(key string) cacheItem[T] {
+	item := cacheItem[T]{key: key, value: cache.value[key], err: cache.err[key]}
+
+	delete(cache.value, key)
+	delete(cache.err, key)
+	delete(cache.lastUse, key)
+
+	if e, ok := cache.elem[key]; ok {
+		cache.lru.Remove(e)
+		delete(cache.elem, key)
+	}
+
+	cache.bytes -= cache.size[key]
+	delete(cache.size, key)
+	delete(cache.hits, key)
+
+	cache.stats.Evictions++
+	return item
+}
+
+// evict removes the least recently used items until the cache fits in its limits
+//
+// @keep is never removed, so a new item that is bigger than MaxBytes stays in the cache until the next item is added
+//
+// the cache must be locked
+func (cache *CacheMap[T]) evict(keep string) []cacheItem[T] {
+	evicted := []cacheItem[T]{}
+
+	for e := cache.lru.Back(); e != nil; {
+		over := (cache.opts.MaxEntries > 0 && cache.lru.Len() > cache.opts.MaxEntries) ||
+			(cache.opts.MaxBytes > 0 && cache.bytes > cache.opts.MaxBytes)
+		if !over {
+			break
+		}
+
+		prev := e.Prev()
+		if key := e.Value.(string); key != keep {
+			evicted = append(evicted, cache.del(key))
 		}
+		e = prev
+	}
+
+	return evicted
+}
+
+// sizeOf returns the size of a value with the Size func of the cache
+//
+// this runs while the cache is locked, so the Size func should only read a size that was measured before
+func (cache *CacheMap[T]) sizeOf(value T) int64 {
+	if cache.opts.Size == nil {
+		return 0
+	}
+	return cache.opts.Size(value)
+}
+
+// onEvict calls OnEvict for every removed item
+//
+// the cache must not be locked
+func (cache *CacheMap[T]) onEvict(evicted []cacheItem[T]) {
+	if len(evicted) == 0 {
+		return
+	}
+
+	cache.mu.Lock()
+	fn := cache.opts.OnEvict
+	cache.mu.Unlock()
+
+	if fn == nil {
+		return
+	}
+	for _, item := range evicted {
+		fn(item.key, item.value, item.err)
 	}
 }
@@ -0,0 +1,154 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// cgroupNoLimit is the smallest memory.limit_in_bytes that cgroup v1 uses for no limit (a page aligned max int64)
+const cgroupNoLimit = 1 << 62
+
+var sysRoot = "/"
+var sysRootMu sync.Mutex
+
+// SetSysRoot sets the root that the procfs and sysfs files are read from (default: "/")
+//
+// this is useful to test the cgroup memory detection against fake files
+func SetSysRoot(root string) {
+	sysRootMu.Lock()
+	defer sysRootMu.Unlock()
+
+	if root == "" {
+		root = "/"
+	}
+	sysRoot = root
+}
+
+// getSysRoot returns the root set by SetSysRoot
+func getSysRoot() string {
+	sysRootMu.Lock()
+	defer sysRootMu.Unlock()
+
+	return sysRoot
+}
+
+// CgroupMemory returns the memory limit and usage in bytes of the cgroup of this process
+//
+// both cgroup v2 (memory.max, memory.current) and v1 (memory.limit_in_bytes, memory.usage_in_bytes) are supported,
+// and the lowest limit of the cgroup and its parents is used
+//
+// the usage does not count inactive file cache, because the kernel can free it before it runs out of memory
+//
+// returns false if there is no cgroup memory limit (or it cannot be read)
+func CgroupMemory() (limit uint64, usage uint64, ok bool) {
+	root := getSysRoot()
+
+	data, err := os.ReadFile(filepath.Join(root, "proc/self/cgroup"))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// each line is hierarchy-ID:controller-list:cgroup-path
+	var v1, v2 string
+	hasV1, hasV2 := false, false
+	for _, line := range strings.Split(string(data), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if parts[0] == "0" && parts[1] == "" {
+			v2, hasV2 = parts[2], true
+			continue
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			if c == "memory" {
+				v1, hasV1 = parts[2], true
+			}
+		}
+	}
+
+	// a host with both versions mounted only uses the memory controller of v1
+	if hasV1 {
+		return cgroupMemory(filepath.Join(root, "sys/fs/cgroup/memory"), v1, "memory.limit_in_bytes", "memory.usage_in_bytes", "total_inactive_file")
+	} else if hasV2 {
+		return cgroupMemory(filepath.Join(root, "sys/fs/cgroup"), v2, "memory.max", "memory.current", "inactive_file")
+	}
+	return 0, 0, false
+}
+
+// cgroupMemory reads the memory limit and usage of a cgroup in a cgroup mount
+//
+// in a cgroup namespace (ie: a container), the mount is the cgroup of the process, so its path does not exist in the mount
+// and the files at the top of the mount are used instead
+func cgroupMemory(mount string, path string, limitFile string, usageFile string, inactiveStat string) (uint64, uint64, bool) {
+	dir := filepath.Join(mount, path)
+	if _, err := os.Stat(filepath.Join(dir, usageFile)); err != nil {
+		dir = mount
+	}
+
+	usage, ok := readCgroupInt(filepath.Join(dir, usageFile))
+	if !ok {
+		return 0, 0, false
+	}
+
+	// a parent can have a lower limit than the cgroup itself
+	limit := uint64(0)
+	for d := dir; ; d = filepath.Dir(d) {
+		if l, ok := readCgroupInt(filepath.Join(d, limitFile)); ok && l < cgroupNoLimit && (limit == 0 || l < limit) {
+			limit = l
+		}
+		if d == mount || len(d) <= len(mount) {
+			break
+		}
+	}
+	if limit == 0 {
+		return 0, 0, false
+	}
+
+	if inactive, ok := readCgroupStat(filepath.Join(dir, "memory.stat"), inactiveStat); ok && inactive < usage {
+		usage -= inactive
+	}
+
+	return limit, usage, true
+}
+
+// readCgroupInt reads a cgroup file with one number
+//
+// returns false for "max" (no limit)
+func readCgroupInt(path string) (uint64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+
+	n, err := strconv.ParseUint(string(bytes.TrimSpace(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// readCgroupStat reads one value from a memory.stat file
+func readCgroupStat(path string, key string) (uint64, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == key {
+			n, err := strconv.ParseUint(fields[1], 10, 64)
+			return n, err == nil
+		}
+	}
+	return 0, false
+}
@@ -15,7 +15,30 @@ func JoinBytes(bytes ...interface{}) []byte {
 }
 
 // SysFreeMemory returns the amount of memory available in megabytes
+//
+// inside a cgroup with a memory limit (ie: a container), this is the lower of the free system memory
+// and the memory left in the cgroup (see CgroupMemory)
 func SysFreeMemory() float64 {
+	free := sysinfoFreeMemory()
+
+	if limit, usage, ok := CgroupMemory(); ok {
+		left := 0.0
+		if usage < limit {
+			left = float64(limit - usage)
+		}
+
+		// 0 means the free memory is unknown, so a full cgroup still returns the smallest value
+		left = math.Max(math.Round(left / 1024 / 1024 * 100) / 100, 0.01)
+		if free == 0 || left < free {
+			return left
+		}
+	}
+
+	return free
+}
+
+// sysinfoFreeMemory returns the free system memory in megabytes
+func sysinfoFreeMemory() float64 {
 	in := &syscall.Sysinfo_t{}
 	err := syscall.Sysinfo(in)
 	if err != nil {
@@ -0,0 +1,145 @@
+package regex
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+//* PCRE context methods
+
+// RepFuncCtx is the same as RepFuncTry, but stops with ctx.Err() once the context is canceled
+//
+// the context is checked between matches
+func (reg *Regexp) RepFuncCtx(ctx context.Context, str []byte, rep func(data func(int) []byte) []byte, blank ...bool) ([]byte, error) {
+	res, err := repFunc(reg.Matches(str).withContext(ctx), str, rep, len(blank) != 0)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RepStrCtx is the same as RepStrTry, but stops with ctx.Err() once the context is canceled
+//
+// the context is checked between matches
+func (reg *Regexp) RepStrCtx(ctx context.Context, str []byte, rep []byte) ([]byte, error) {
+	res, err := repStr(reg.Matches(str).withContext(ctx), str, rep)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RepFileStrCtx is the same as RepFileStr, but stops with ctx.Err() once the context is canceled
+//
+// the file is replaced the same way as RepFileStrAtomic, so canceling the context (or a crash) never leaves the file half written,
+// and @file still has the old content after this (open the file again to read the result)
+//
+// returns io.EOF if there was no match
+func (reg *Regexp) RepFileStrCtx(ctx context.Context, file *os.File, rep []byte, all bool, maxReSize ...int64) error {
+	return repFileCtx(ctx, reg, reg.len, file, all, maxReSize, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFileFuncCtx is the same as RepFileFunc, but stops with ctx.Err() once the context is canceled
+//
+// the file is replaced the same way as RepFileFuncAtomic, so canceling the context (or a crash) never leaves the file half written,
+// and @file still has the old content after this (open the file again to read the result)
+//
+// returns io.EOF if there was no match
+func (reg *Regexp) RepFileFuncCtx(ctx context.Context, file *os.File, rep func(data func(int) []byte) []byte, all bool, maxReSize ...int64) error {
+	return repFileCtx(ctx, reg, reg.len, file, all, maxReSize, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+// MatchFileCtx is the same as MatchFile, but stops with ctx.Err() once the context is canceled
+//
+// the context is checked between chunks of the file
+func (reg *Regexp) MatchFileCtx(ctx context.Context, file *os.File, maxReSize ...int64) (bool, error) {
+	return matchFileCtx(ctx, reg, file, fileWindow(reg.len, maxReSize))
+}
+
+//* RE2 context methods
+
+// RepFuncCtx is the same as RepFunc, but stops with ctx.Err() once the context is canceled
+//
+// the context is checked between matches
+func (reg *RegexpRE2) RepFuncCtx(ctx context.Context, str []byte, rep func(data func(int) []byte) []byte, blank ...bool) ([]byte, error) {
+	res, err := repFunc(reg.Matches(str).withContext(ctx), str, rep, len(blank) != 0)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RepStrCtx is the same as RepStr, but stops with ctx.Err() once the context is canceled
+//
+// the context is checked between matches
+func (reg *RegexpRE2) RepStrCtx(ctx context.Context, str []byte, rep []byte) ([]byte, error) {
+	res, err := repStr(reg.Matches(str).withContext(ctx), str, rep)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RepFileStrCtx is the same as RepFileStr, but stops with ctx.Err() once the context is canceled
+//
+// the file is replaced the same way as RepFileStrAtomic, so canceling the context (or a crash) never leaves the file half written,
+// and @file still has the old content after this (open the file again to read the result)
+//
+// returns io.EOF if there was no match
+func (reg *RegexpRE2) RepFileStrCtx(ctx context.Context, file *os.File, rep []byte, all bool, maxReSize ...int64) error {
+	return repFileCtx(ctx, reg, reg.len, file, all, maxReSize, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFileFuncCtx is the same as RepFileFunc, but stops with ctx.Err() once the context is canceled
+//
+// the file is replaced the same way as RepFileFuncAtomic, so canceling the context (or a crash) never leaves the file half written,
+// and @file still has the old content after this (open the file again to read the result)
+//
+// returns io.EOF if there was no match
+func (reg *RegexpRE2) RepFileFuncCtx(ctx context.Context, file *os.File, rep func(data func(int) []byte) []byte, all bool, maxReSize ...int64) error {
+	return repFileCtx(ctx, reg, reg.len, file, all, maxReSize, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+// MatchFileCtx is the same as MatchFile, but stops with ctx.Err() once the context is canceled
+//
+// the context is checked between chunks of the file
+func (reg *RegexpRE2) MatchFileCtx(ctx context.Context, file *os.File, maxReSize ...int64) (bool, error) {
+	return matchFileCtx(ctx, reg, file, fileWindow(reg.len, maxReSize))
+}
+
+//* shared context methods
+
+// repFileCtx replaces the matches in a file with the result of @rep, and renames the result over the file (see repFileAtomic)
+func repFileCtx(ctx context.Context, reg matcher, reLen int64, file *os.File, all bool, maxReSize []int64, rep func(m *Match) []byte) error {
+	var o FileOptions
+	if len(maxReSize) != 0 {
+		o.MaxReSize = maxReSize[0]
+	}
+
+	count, err := repFileAtomic(ctx, reg, reLen, file.Name(), all, []FileOptions{o}, rep)
+	if err != nil {
+		return err
+	} else if count == 0 {
+		return io.EOF
+	}
+	return nil
+}
+
+// matchFileCtx returns true if a file contains a match
+func matchFileCtx(ctx context.Context, reg matcher, file *os.File, window int64) (bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	return matchStream(ctx, reg, io.NewSectionReader(file, 0, info.Size()), int(window))
+}
@@ -0,0 +1,480 @@
+package regex
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrInputChanged is returned by WriteDiff when the input no longer has the text found by the dry run
+var ErrInputChanged = errors.New("regex: input changed after the dry run")
+
+// Hunk is one replacement found by a dry run
+type Hunk struct {
+	// Offset is the byte offset of the match in the original input
+	Offset int64
+
+	// Line is the line number of the start of the match (starting at 1)
+	Line int
+
+	// Old is the text of the match, and New is the text it would be replaced with
+	Old []byte
+	New []byte
+}
+
+// DryRun has the replacements a replace method would make, without changing the input
+//
+// use WriteDiff or Diff to get a unified diff
+type DryRun struct {
+	Hunks []Hunk
+
+	src  io.ReaderAt
+	size int64
+}
+
+//* PCRE dry run methods
+
+// RepStrDryRun returns the replacements RepStr would make
+func (reg *Regexp) RepStrDryRun(str []byte, rep []byte) *DryRun {
+	return dryRun(reg.Matches(str), str, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFuncDryRun returns the replacements RepFunc would make
+//
+// if @rep returns nil, the match would be removed, and the loop stops (the same as RepFunc)
+func (reg *Regexp) RepFuncDryRun(str []byte, rep func(data func(int) []byte) []byte) *DryRun {
+	return dryRun(reg.Matches(str), str, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+// RepFileStrDryRun returns the replacements RepFileStrAtomic and RepFileStrCtx would make, and leaves the file untouched
+//
+// the file is read again by WriteDiff, so it must stay open until then
+//
+// note: with @all set to false, only the first match is replaced,
+// while the older RepFileStr replaces every match in the first chunk of the file
+//
+// @all: if true, will replace all text matching @re,
+// if false, will only replace the first occurrence
+func (reg *Regexp) RepFileStrDryRun(file *os.File, rep []byte, all bool, maxReSize ...int64) (*DryRun, error) {
+	return dryRunFile(reg, file, fileWindow(reg.len, maxReSize), all, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFileFuncDryRun returns the replacements RepFileFuncAtomic and RepFileFuncCtx would make, and leaves the file untouched
+//
+// the file is read again by WriteDiff, so it must stay open until then
+//
+// note: with @all set to false, only the first match is replaced,
+// while the older RepFileFunc replaces every match in the first chunk of the file
+//
+// @all: if true, will replace all text matching @re,
+// if false, will only replace the first occurrence
+func (reg *Regexp) RepFileFuncDryRun(file *os.File, rep func(data func(int) []byte) []byte, all bool, maxReSize ...int64) (*DryRun, error) {
+	return dryRunFile(reg, file, fileWindow(reg.len, maxReSize), all, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+//* RE2 dry run methods
+
+// RepStrDryRun returns the replacements RepStr would make
+func (reg *RegexpRE2) RepStrDryRun(str []byte, rep []byte) *DryRun {
+	return dryRun(reg.Matches(str), str, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFuncDryRun returns the replacements RepFunc would make
+//
+// if @rep returns nil, the match would be removed, and the loop stops (the same as RepFunc)
+func (reg *RegexpRE2) RepFuncDryRun(str []byte, rep func(data func(int) []byte) []byte) *DryRun {
+	return dryRun(reg.Matches(str), str, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+// RepFileStrDryRun returns the replacements RepFileStrAtomic and RepFileStrCtx would make, and leaves the file untouched
+//
+// the file is read again by WriteDiff, so it must stay open until then
+//
+// note: with @all set to false, only the first match is replaced,
+// while the older RepFileStr replaces every match in the first chunk of the file
+//
+// @all: if true, will replace all text matching @re,
+// if false, will only replace the first occurrence
+func (reg *RegexpRE2) RepFileStrDryRun(file *os.File, rep []byte, all bool, maxReSize ...int64) (*DryRun, error) {
+	return dryRunFile(reg, file, fileWindow(reg.len, maxReSize), all, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFileFuncDryRun returns the replacements RepFileFuncAtomic and RepFileFuncCtx would make, and leaves the file untouched
+//
+// the file is read again by WriteDiff, so it must stay open until then
+//
+// note: with @all set to false, only the first match is replaced,
+// while the older RepFileFunc replaces every match in the first chunk of the file
+//
+// @all: if true, will replace all text matching @re,
+// if false, will only replace the first occurrence
+func (reg *RegexpRE2) RepFileFuncDryRun(file *os.File, rep func(data func(int) []byte) []byte, all bool, maxReSize ...int64) (*DryRun, error) {
+	return dryRunFile(reg, file, fileWindow(reg.len, maxReSize), all, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+//* shared dry run methods
+
+// dryRun returns the replacements of every match of an iterator
+func dryRun(it *MatchIter, str []byte, rep func(m *Match) []byte) *DryRun {
+	d := &DryRun{Hunks: []Hunk{}, src: bytes.NewReader(str), size: int64(len(str))}
+
+	line := 1
+	pos := 0
+	for it.Next() {
+		m := it.Match()
+
+		line += bytes.Count(str[pos:m.Start()], []byte{'\n'})
+		pos = m.Start()
+
+		r := rep(m)
+		d.Hunks = append(d.Hunks, Hunk{
+			Offset: int64(m.Start()),
+			Line:   line,
+			Old:    append([]byte{}, m.Bytes()...),
+			New:    append([]byte{}, r...),
+		})
+
+		if r == nil {
+			break
+		}
+	}
+
+	return d
+}
+
+// dryRunFile returns the replacements in a file, the same way as repStream would make them
+func dryRunFile(reg matcher, file *os.File, window int64, all bool, rep func(m *Match) []byte) (*DryRun, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DryRun{Hunks: []Hunk{}, src: file, size: info.Size()}
+
+	n := -1
+	if !all {
+		n = 1
+	}
+
+	// the output is only counted, and the difference between the output and the input gives the offsets
+	out := &countWriter{}
+	delta := int64(0)
+	lineDelta := 0
+
+	_, err = repStream(context.Background(), reg, out, io.NewSectionReader(file, 0, info.Size()), int(window), n, func(m *Match) []byte {
+		r := rep(m)
+		old := m.Bytes()
+
+		d.Hunks = append(d.Hunks, Hunk{
+			Offset: out.n - delta,
+			Line:   1 + out.lines - lineDelta,
+			Old:    append([]byte{}, old...),
+			New:    append([]byte{}, r...),
+		})
+
+		delta += int64(len(r) - len(old))
+		lineDelta += bytes.Count(r, []byte{'\n'}) - bytes.Count(old, []byte{'\n'})
+		return r
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// countWriter counts the bytes and lines written to it
+type countWriter struct {
+	n     int64
+	lines int
+}
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	w.n += int64(len(b))
+	w.lines += bytes.Count(b, []byte{'\n'})
+	return len(b), nil
+}
+
+// Diff returns the replacements as a unified diff (see WriteDiff)
+func (d *DryRun) Diff(name string, contextLines int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.WriteDiff(&buf, name, contextLines); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteDiff writes the replacements as a unified diff
+//
+// nothing is written if there are no replacements
+//
+// @name: the file name for the --- and +++ lines
+//
+// @contextLines: the number of unchanged lines around each change (diff -u uses 3)
+func (d *DryRun) WriteDiff(w io.Writer, name string, contextLines int) error {
+	if len(d.Hunks) == 0 {
+		return nil
+	}
+
+	dw := &diffWriter{w: bufio.NewWriter(w), context: max(contextLines, 0)}
+	fmt.Fprintf(dw.w, "--- %s\n+++ %s\n", name, name)
+
+	br := bufio.NewReader(io.NewSectionReader(d.src, 0, d.size))
+	pos := int64(0)
+	last := false
+
+	readLine := func() ([]byte, error) {
+		text, err := br.ReadBytes('\n')
+		pos += int64(len(text))
+		if err == io.EOF {
+			last = true
+			return text, nil
+		}
+		return text, err
+	}
+
+	// inLine returns true if a replacement starts in the lines read so far
+	// (a replacement at the end of the input belongs to the last line)
+	inLine := func(h Hunk) bool {
+		return h.Offset < pos || (last && h.Offset <= pos)
+	}
+
+	hi := 0
+	for !last {
+		text, err := readLine()
+		if err != nil {
+			return err
+		}
+		if last && len(text) == 0 && hi == len(d.Hunks) {
+			break
+		}
+
+		if hi == len(d.Hunks) || !inLine(d.Hunks[hi]) {
+			dw.same(text)
+			continue
+		}
+
+		block := text
+		blockStart := pos - int64(len(text))
+		j := hi
+		var res []byte
+		for {
+			// read every line used by the replacements that start in the block
+			for j < len(d.Hunks) && inLine(d.Hunks[j]) {
+				for !last && d.Hunks[j].Offset+int64(len(d.Hunks[j].Old)) > pos {
+					more, err := readLine()
+					if err != nil {
+						return err
+					}
+					block = append(block, more...)
+				}
+				j++
+			}
+
+			res = []byte{}
+			p := int64(0)
+			for _, h := range d.Hunks[hi:j] {
+				start := h.Offset - blockStart
+				end := start + int64(len(h.Old))
+				if start < p || end > int64(len(block)) || !bytes.Equal(block[start:end], h.Old) {
+					return ErrInputChanged
+				}
+
+				res = append(res, block[p:start]...)
+				res = append(res, h.New...)
+				p = end
+			}
+			res = append(res, block[p:]...)
+
+			// if a replacement removed the newline at the end of the block,
+			// the next line is joined to the last new line, so it is part of the same change
+			if last || len(res) == 0 || res[len(res)-1] == '\n' {
+				break
+			}
+			more, err := readLine()
+			if err != nil {
+				return err
+			}
+			block = append(block, more...)
+		}
+		hi = j
+
+		dw.change(splitLines(block), splitLines(res))
+	}
+
+	if hi != len(d.Hunks) {
+		return ErrInputChanged
+	}
+
+	dw.flush()
+	return dw.w.Flush()
+}
+
+// diffWriter builds the hunks of a unified diff one line at a time
+type diffWriter struct {
+	w       *bufio.Writer
+	context int
+
+	// oldLine and newLine are the number of lines read so far
+	oldLine int
+	newLine int
+
+	// before has the last unchanged lines, for the context before a change
+	before [][]byte
+
+	// hunk is the current hunk, and trailing is the number of unchanged lines at the end of it
+	hunk     *diffHunk
+	trailing int
+
+	// old and new have the lines of the current changes
+	old [][]byte
+	new [][]byte
+}
+
+type diffHunk struct {
+	oldStart, oldCount int
+	newStart, newCount int
+	lines              []diffLine
+}
+
+type diffLine struct {
+	op   byte
+	text []byte
+}
+
+// endChange adds the old and new lines of the changes since the last unchanged line
+func (dw *diffWriter) endChange() {
+	for _, text := range dw.old {
+		dw.hunk.lines = append(dw.hunk.lines, diffLine{'-', text})
+	}
+	for _, text := range dw.new {
+		dw.hunk.lines = append(dw.hunk.lines, diffLine{'+', text})
+	}
+	dw.old = dw.old[:0]
+	dw.new = dw.new[:0]
+}
+
+// same adds an unchanged line
+func (dw *diffWriter) same(text []byte) {
+	if dw.hunk != nil {
+		dw.endChange()
+	}
+
+	dw.oldLine++
+	dw.newLine++
+
+	if dw.hunk != nil {
+		if dw.trailing == dw.context*2 {
+			// the next change is too far away to be in the same hunk
+			dw.flush()
+		} else {
+			dw.hunk.lines = append(dw.hunk.lines, diffLine{' ', text})
+			dw.hunk.oldCount++
+			dw.hunk.newCount++
+			dw.trailing++
+		}
+	}
+
+	if dw.context > 0 {
+		dw.before = append(dw.before, text)
+		if len(dw.before) > dw.context {
+			dw.before = dw.before[1:]
+		}
+	}
+}
+
+// change adds the old lines of a change, and the new lines that replace them
+func (dw *diffWriter) change(old [][]byte, new [][]byte) {
+	if dw.hunk == nil {
+		dw.hunk = &diffHunk{
+			oldStart: dw.oldLine - len(dw.before) + 1,
+			newStart: dw.newLine - len(dw.before) + 1,
+		}
+		for _, text := range dw.before {
+			dw.hunk.lines = append(dw.hunk.lines, diffLine{' ', text})
+		}
+		dw.hunk.oldCount = len(dw.before)
+		dw.hunk.newCount = len(dw.before)
+	}
+
+	// changes next to each other are written together, with the old lines first
+	dw.old = append(dw.old, old...)
+	dw.new = append(dw.new, new...)
+
+	dw.hunk.oldCount += len(old)
+	dw.hunk.newCount += len(new)
+	dw.oldLine += len(old)
+	dw.newLine += len(new)
+	dw.trailing = 0
+	dw.before = dw.before[:0]
+}
+
+// flush writes the current hunk, with at most @context unchanged lines at the end
+func (dw *diffWriter) flush() {
+	h := dw.hunk
+	if h == nil {
+		return
+	}
+	dw.endChange()
+	dw.hunk = nil
+
+	if extra := dw.trailing - dw.context; extra > 0 {
+		h.lines = h.lines[:len(h.lines)-extra]
+		h.oldCount -= extra
+		h.newCount -= extra
+	}
+	dw.trailing = 0
+
+	// an empty range starts at the line before it (the same as diff -u)
+	oldStart, newStart := h.oldStart, h.newStart
+	if h.oldCount == 0 {
+		oldStart--
+	}
+	if h.newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(dw.w, "@@ -%d,%d +%d,%d @@\n", oldStart, h.oldCount, newStart, h.newCount)
+
+	for _, l := range h.lines {
+		dw.w.WriteByte(l.op)
+		dw.w.Write(l.text)
+		if len(l.text) == 0 || l.text[len(l.text)-1] != '\n' {
+			dw.w.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// splitLines splits a string into lines, and keeps the newline at the end of each line
+func splitLines(b []byte) [][]byte {
+	lines := [][]byte{}
+	for len(b) != 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i == -1 {
+			lines = append(lines, b)
+			break
+		}
+		lines = append(lines, b[:i+1])
+		b = b[i+1:]
+	}
+	return lines
+}
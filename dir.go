@@ -0,0 +1,422 @@
+package regex
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// WalkOptions changes which files the Dir methods visit
+type WalkOptions struct {
+	// FileOptions is used for every file that is replaced
+	FileOptions
+
+	// Include only visits files that match one of these globs (empty for all files)
+	//
+	// a glob without a "/" matches the file name, and a glob with a "/" matches the path relative to the root
+	// (use ** to match any number of directories, ie: src/**/*.go)
+	Include []string
+
+	// Exclude skips files and directories that match one of these globs
+	Exclude []string
+
+	// NoGitignore does not read .gitignore files
+	//
+	// by default, the .gitignore files in the tree are honored, and .git directories are skipped
+	NoGitignore bool
+
+	// Binary also visits binary files (files with a null byte in the first 8000 bytes, the same check git uses)
+	Binary bool
+
+	// Workers is the number of files to search at the same time (default: the number of CPUs)
+	Workers int
+}
+
+// DirResult is the result of one file from a Dir method
+type DirResult struct {
+	// Path is the path of the file (joined with the root)
+	Path string
+
+	// Matches has the matches in the file (only for FindAllDir)
+	Matches []*FileMatch
+
+	// Count is the number of matches or replacements
+	Count int
+
+	// Err is the error that stopped the file from being searched or replaced
+	Err error
+}
+
+//* PCRE dir methods
+
+// FindAllDir finds every match in a directory tree
+//
+// only files with a match or an error are returned, sorted by path
+//
+// symlinks are never followed, and the error is only for a root that cannot be read
+//
+// @contextLines: the number of lines to keep before and after each match (like grep -C)
+func (reg *Regexp) FindAllDir(root string, contextLines int, opts ...WalkOptions) ([]*DirResult, error) {
+	return findAllDir(reg, reg.len, root, contextLines, opts)
+}
+
+// RepDirStr replaces every match in a directory tree, the same as RepFileStrAtomic
+//
+// only files with a replacement or an error are returned, sorted by path
+//
+// symlinks are never followed, and the error is only for a root that cannot be read
+func (reg *Regexp) RepDirStr(root string, rep []byte, opts ...WalkOptions) ([]*DirResult, error) {
+	return repDir(reg, reg.len, root, opts, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepDirFunc replaces every match in a directory tree with the result of a function, the same as RepFileFuncAtomic
+//
+// only files with a replacement or an error are returned, sorted by path
+//
+// note: files are replaced at the same time, so @rep must be safe to call from multiple goroutines
+func (reg *Regexp) RepDirFunc(root string, rep func(data func(int) []byte) []byte, opts ...WalkOptions) ([]*DirResult, error) {
+	return repDir(reg, reg.len, root, opts, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+//* RE2 dir methods
+
+// FindAllDir finds every match in a directory tree
+//
+// only files with a match or an error are returned, sorted by path
+//
+// symlinks are never followed, and the error is only for a root that cannot be read
+//
+// @contextLines: the number of lines to keep before and after each match (like grep -C)
+func (reg *RegexpRE2) FindAllDir(root string, contextLines int, opts ...WalkOptions) ([]*DirResult, error) {
+	return findAllDir(reg, reg.len, root, contextLines, opts)
+}
+
+// RepDirStr replaces every match in a directory tree, the same as RepFileStrAtomic
+//
+// only files with a replacement or an error are returned, sorted by path
+//
+// symlinks are never followed, and the error is only for a root that cannot be read
+func (reg *RegexpRE2) RepDirStr(root string, rep []byte, opts ...WalkOptions) ([]*DirResult, error) {
+	return repDir(reg, reg.len, root, opts, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepDirFunc replaces every match in a directory tree with the result of a function, the same as RepFileFuncAtomic
+//
+// only files with a replacement or an error are returned, sorted by path
+//
+// note: files are replaced at the same time, so @rep must be safe to call from multiple goroutines
+func (reg *RegexpRE2) RepDirFunc(root string, rep func(data func(int) []byte) []byte, opts ...WalkOptions) ([]*DirResult, error) {
+	return repDir(reg, reg.len, root, opts, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+//* shared dir methods
+
+// findAllDir finds every match in a directory tree
+func findAllDir(reg matcher, reLen int64, root string, contextLines int, opts []WalkOptions) ([]*DirResult, error) {
+	var o WalkOptions
+	if len(opts) != 0 {
+		o = opts[0]
+	}
+
+	window := int(fileWindow(reLen, []int64{o.MaxReSize}))
+	return walkDir(root, o, func(file *os.File, res *DirResult) {
+		res.Matches, res.Err = findAllStream(context.Background(), reg, file, window, contextLines)
+		res.Count = len(res.Matches)
+	})
+}
+
+// repDir replaces every match in a directory tree
+func repDir(reg matcher, reLen int64, root string, opts []WalkOptions, rep func(m *Match) []byte) ([]*DirResult, error) {
+	var o WalkOptions
+	if len(opts) != 0 {
+		o = opts[0]
+	}
+
+	return walkDir(root, o, func(file *os.File, res *DirResult) {
+		// the file is only used for the binary check, and is replaced by its path
+		file.Close()
+		res.Count, res.Err = repFileAtomic(context.Background(), reg, reLen, res.Path, true, []FileOptions{o.FileOptions}, rep)
+	})
+}
+
+// walkDir calls @visit for every file in a directory tree, using a pool of workers
+//
+// @visit gets the file after the binary check (at offset 0), and sets the count and error of the result
+func walkDir(root string, opts WalkOptions, visit func(file *os.File, res *DirResult)) ([]*DirResult, error) {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	files := make(chan string, workers)
+	results := []*DirResult{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range files {
+				res := &DirResult{Path: path}
+				visitFile(res, opts.Binary, visit)
+
+				if res.Count != 0 || res.Err != nil {
+					mu.Lock()
+					results = append(results, res)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	ignore := map[string][]ignoreRule{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			mu.Lock()
+			results = append(results, &DirResult{Path: p, Err: err})
+			mu.Unlock()
+			return nil
+		}
+
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if p != root {
+				if (!opts.NoGitignore && d.Name() == ".git") || matchGlobs(opts.Exclude, rel) || (!opts.NoGitignore && ignored(ignore, rel, true)) {
+					return filepath.SkipDir
+				}
+			}
+			if !opts.NoGitignore {
+				if rules := readGitignore(filepath.Join(p, ".gitignore")); len(rules) != 0 {
+					if rel == "." {
+						rel = ""
+					}
+					ignore[rel] = rules
+				}
+			}
+			return nil
+		}
+
+		// skip symlinks and special files
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if p != root {
+			if len(opts.Include) != 0 && !matchGlobs(opts.Include, rel) {
+				return nil
+			}
+			if matchGlobs(opts.Exclude, rel) || (!opts.NoGitignore && ignored(ignore, rel, false)) {
+				return nil
+			}
+		}
+
+		files <- p
+		return nil
+	})
+
+	close(files)
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+
+	return results, err
+}
+
+// visitFile opens a file, skips it if it is binary, and calls @visit
+func visitFile(res *DirResult, binary bool, visit func(file *os.File, res *DirResult)) {
+	file, err := os.Open(res.Path)
+	if err != nil {
+		res.Err = err
+		return
+	}
+	defer file.Close()
+
+	if !binary {
+		head := make([]byte, 8000)
+		n, err := io.ReadFull(file, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			res.Err = err
+			return
+		}
+		if bytes.IndexByte(head[:n], 0) != -1 {
+			return
+		}
+
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			res.Err = err
+			return
+		}
+	}
+
+	visit(file, res)
+}
+
+// matchGlobs returns true if a path (relative to the root, with "/") matches one of the globs
+//
+// a glob without a "/" only matches the file name (a trailing "/" is ignored, the same as .gitignore)
+func matchGlobs(globs []string, rel string) bool {
+	for _, g := range globs {
+		g = strings.TrimSuffix(g, "/")
+		if strings.Contains(g, "/") {
+			if matchGlob(strings.TrimPrefix(g, "/"), rel) {
+				return true
+			}
+		} else if ok, _ := path.Match(g, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a path with a glob, where ** matches any number of directories
+func matchGlob(glob string, name string) bool {
+	return matchGlobParts(strings.Split(glob, "/"), strings.Split(name, "/"))
+}
+
+func matchGlobParts(glob []string, name []string) bool {
+	for len(glob) != 0 {
+		if glob[0] == "**" {
+			if len(glob) == 1 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchGlobParts(glob[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], name[0]); !ok {
+			return false
+		}
+
+		glob, name = glob[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ignoreRule is one pattern from a .gitignore file
+type ignoreRule struct {
+	glob     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// readGitignore reads the rules of a .gitignore file
+//
+// this supports the common syntax: comments, ! to negate, a trailing / for directories,
+// a leading or middle / to match from the .gitignore directory, and **
+func readGitignore(name string) []ignoreRule {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	rules := []ignoreRule{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		rule := ignoreRule{}
+		if line[0] == '!' {
+			rule.negate = true
+			line = line[1:]
+		} else if line[0] == '\\' {
+			line = line[1:]
+		}
+
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line != "" {
+			rule.glob = line
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// ignored returns true if a path is ignored by the .gitignore files of its parent directories
+//
+// the rules of deeper directories override the rules of their parents, and the last matching rule wins
+func ignored(ignore map[string][]ignoreRule, rel string, isDir bool) bool {
+	res := false
+
+	dirs := []string{""}
+	for i, c := range rel {
+		if c == '/' {
+			dirs = append(dirs, rel[:i])
+		}
+	}
+
+	for _, dir := range dirs {
+		rules, ok := ignore[dir]
+		if !ok {
+			continue
+		}
+
+		name := rel
+		if dir != "" {
+			name = rel[len(dir)+1:]
+		}
+
+		for _, rule := range rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+
+			var match bool
+			if rule.anchored {
+				match = matchGlob(rule.glob, name)
+			} else {
+				match, _ = path.Match(rule.glob, path.Base(name))
+			}
+
+			if match {
+				res = !rule.negate
+			}
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,102 @@
+package regex
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Engine is a compiled regex that can be used without knowing which regex module compiled it
+//
+// both *Regexp (PCRE) and *RegexpRE2 implement this interface
+type Engine interface {
+	Match(str []byte) bool
+	Split(str []byte) [][]byte
+	RepStr(str []byte, rep []byte) []byte
+	RepStrLit(str []byte, rep []byte) []byte
+	RepFunc(str []byte, rep func(data func(int) []byte) []byte, blank ...bool) []byte
+	RepFileStr(file *os.File, rep []byte, all bool, maxReSize ...int64) error
+	RepFileFunc(file *os.File, rep func(data func(int) []byte) []byte, all bool, maxReSize ...int64) error
+	MatchFile(file *os.File, maxReSize ...int64) bool
+}
+
+var _ Engine = (*Regexp)(nil)
+var _ Engine = (*RegexpRE2)(nil)
+
+// EngineComp compiles a regex for an engine, and returns an error if it fails to compile
+type EngineComp func(re string, params ...string) (Engine, error)
+
+// ErrUnknownEngine is returned when compiling with an engine that has not been registered
+var ErrUnknownEngine = errors.New("regex: unknown engine")
+
+var engines = map[string]EngineComp{
+	"pcre": func(re string, params ...string) (Engine, error) {
+		reg, err := CompTry(re, params...)
+		if err != nil {
+			return nil, err
+		}
+		return reg, nil
+	},
+	"re2": func(re string, params ...string) (Engine, error) {
+		reg, err := CompTryRE2(re, params...)
+		if err != nil {
+			return nil, err
+		}
+		return reg, nil
+	},
+}
+var enginesMu sync.RWMutex
+
+// RegisterEngine adds a new regex engine, or replaces an existing one
+//
+// "pcre" and "re2" are registered by default
+func RegisterEngine(name string, comp EngineComp) {
+	enginesMu.Lock()
+	defer enginesMu.Unlock()
+
+	if comp == nil {
+		delete(engines, name)
+		return
+	}
+	engines[name] = comp
+}
+
+// Engines returns the names of every registered engine
+func Engines() []string {
+	enginesMu.RLock()
+	defer enginesMu.RUnlock()
+
+	res := make([]string, 0, len(engines))
+	for name := range engines {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// CompEngine compiles a regular expression with a registered engine
+//
+// this makes it possible to choose the engine from a config file
+//
+// @engine: the name of a registered engine (ie: "pcre" or "re2")
+func CompEngine(engine string, re string, params ...string) Engine {
+	reg, err := CompTryEngine(engine, re, params...)
+	if err != nil {
+		panic(err)
+	}
+	return reg
+}
+
+// CompTryEngine tries to compile with a registered engine or returns an error
+func CompTryEngine(engine string, re string, params ...string) (Engine, error) {
+	enginesMu.RLock()
+	comp, ok := engines[engine]
+	enginesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEngine, engine)
+	}
+	return comp(re, params...)
+}
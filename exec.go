@@ -0,0 +1,70 @@
+package regex
+
+/*
+#cgo pkg-config: libpcre
+#include <pcre.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/GRbit/go-pcre"
+)
+
+// pcreField returns a pointer to an unexported byte slice field of a go-pcre regex (ie: "ptr" or "extra")
+//
+// go-pcre does not expose the compiled pattern or pcre_extra, so they are read with reflect,
+// and nil is returned if the field is missing, empty, or no longer a byte slice
+func pcreField(re *pcre.Regexp, name string) unsafe.Pointer {
+	field := reflect.ValueOf(re).Elem().FieldByName(name)
+	if !field.IsValid() || field.Kind() != reflect.Slice || field.Type().Elem().Kind() != reflect.Uint8 || field.Len() == 0 {
+		return nil
+	}
+	return field.UnsafePointer()
+}
+
+// execAt runs pcre_exec on @str with a start offset, and returns the group offsets of the first match at or after @offset
+//
+// go-pcre always runs pcre_exec from the start of the subject, so the compiled pattern is passed to pcre_exec here,
+// and \b, \B and lookbehind assertions see the text before @offset (the same as RE2)
+//
+// @ok is false if the compiled pattern could not be read from go-pcre
+func execAt(re *pcre.Regexp, str []byte, offset int, flags int) (ind []int, ok bool, err error) {
+	code := pcreField(re, "ptr")
+	if code == nil {
+		return nil, false, nil
+	}
+	extra := pcreField(re, "extra")
+
+	groups := re.Groups()
+	ovector := make([]C.int, 3*(groups+1))
+
+	subject := str
+	if len(subject) == 0 {
+		// make the first char addressable
+		subject = []byte{0}
+	}
+
+	rc := int(C.pcre_exec((*C.pcre)(code), (*C.pcre_extra)(extra),
+		(*C.char)(unsafe.Pointer(&subject[0])), C.int(len(str)), C.int(offset), C.int(flags),
+		&ovector[0], C.int(len(ovector))))
+
+	if rc < 0 {
+		if rc == pcre.ERROR_NOMATCH {
+			return nil, true, nil
+		}
+		if err := limitError(rc); err != nil {
+			return nil, true, err
+		}
+		return nil, true, fmt.Errorf("%d, pcre_exec: failed to match", rc)
+	}
+
+	ind = make([]int, 2*(groups+1))
+	for i := range ind {
+		ind[i] = int(ovector[i])
+	}
+	return ind, true, nil
+}
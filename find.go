@@ -0,0 +1,226 @@
+package regex
+
+import "github.com/GRbit/go-pcre"
+
+// Match holds the result of a regex match
+//
+// the same struct is returned by both the PCRE and RE2 methods
+type Match struct {
+	// Input is the original []byte that was searched
+	Input []byte
+
+	// Index holds the byte offsets of every capture group in Input
+	//
+	// group n starts at Index[2*n] and ends at Index[2*n+1],
+	// both are -1 if the group did not take part in the match
+	Index []int
+
+	// Names holds the names of the capture groups, with an empty name for unnamed groups
+	Names []string
+}
+
+func newMatch(str []byte, ind []int, names []string) *Match {
+	return &Match{Input: str, Index: ind, Names: names}
+}
+
+// Start returns the byte offset where the full match starts
+func (m *Match) Start() int {
+	return m.Index[0]
+}
+
+// End returns the byte offset where the full match ends
+func (m *Match) End() int {
+	return m.Index[1]
+}
+
+// Bytes returns the full match
+func (m *Match) Bytes() []byte {
+	return m.Input[m.Index[0]:m.Index[1]]
+}
+
+// Groups returns the number of capture groups, not including the full match
+func (m *Match) Groups() int {
+	return len(m.Index)/2 - 1
+}
+
+// Group returns a capture group, or nil if it did not take part in the match
+//
+// use 0 to get the full match
+func (m *Match) Group(g int) []byte {
+	if g < 0 || 2*g+1 >= len(m.Index) || m.Index[2*g] < 0 {
+		return nil
+	}
+	return m.Input[m.Index[2*g]:m.Index[2*g+1]]
+}
+
+// GroupIndex returns the start and end offsets of a capture group, or nil if it did not take part in the match
+func (m *Match) GroupIndex(g int) []int {
+	if g < 0 || 2*g+1 >= len(m.Index) || m.Index[2*g] < 0 {
+		return nil
+	}
+	return m.Index[2*g : 2*g+2]
+}
+
+// Named returns a named capture group, or nil if it does not exist or did not take part in the match
+func (m *Match) Named(name string) []byte {
+	return m.Group(m.nameIndex(name))
+}
+
+// NamedGroups returns every named capture group as a map
+func (m *Match) NamedGroups() map[string][]byte {
+	res := map[string][]byte{}
+	for i, n := range m.Names {
+		if n != "" {
+			if _, ok := res[n]; !ok {
+				res[n] = m.Group(i)
+			}
+		}
+	}
+	return res
+}
+
+// data returns a capture group for the data callback of RepFunc
+//
+// groups that do not exist return an empty []byte
+func (m *Match) data(g int) []byte {
+	if g < 0 || g > m.Groups() {
+		return []byte{}
+	}
+	return m.Group(g)
+}
+
+// nameIndex returns the index of the first capture group with the given name, or -1 if there is none
+func (m *Match) nameIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, n := range m.Names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Submatch returns the full match followed by every capture group
+func (m *Match) Submatch() [][]byte {
+	res := make([][]byte, m.Groups()+1)
+	for i := range res {
+		res[i] = m.Group(i)
+	}
+	return res
+}
+
+//* PCRE find methods
+
+// findAt returns the group offsets of the first match at or after @offset
+//
+// the text before @offset is still searched by \b, \B and lookbehind assertions, the same as RE2 (see execAt)
+//
+// the error is set if PCRE failed to match (ie: the match limit was reached)
+func (reg *Regexp) findAt(str []byte, offset int, flags int) ([]int, error) {
+	flags |= reg.flags
+
+	re := reg.re()
+	if ind, ok, err := execAt(re, str, offset, flags); ok {
+		return ind, err
+	}
+
+	// the compiled pattern could not be read from go-pcre, so only the text after @offset is searched
+	if offset > 0 {
+		flags |= pcre.NOTBOL
+	}
+
+	m := re.NewMatcher(str[offset:], flags)
+	if !m.Matches {
+		if m.Error != nil {
+			return nil, execError(m.Error)
+		}
+		return nil, nil
+	}
+
+	ind := make([]int, 2*(m.Groups+1))
+	for i := 0; i <= m.Groups; i++ {
+		if g := m.GroupIndices(i); g != nil {
+			ind[2*i] = offset + g[0]
+			ind[2*i+1] = offset + g[1]
+		} else {
+			ind[2*i] = -1
+			ind[2*i+1] = -1
+		}
+	}
+	return ind, nil
+}
+
+// Find returns the first match, or nil if there is no match
+func (reg *Regexp) Find(str []byte) *Match {
+	ind, _ := reg.findAt(str, 0, 0)
+	if ind == nil {
+		return nil
+	}
+	return newMatch(str, ind, reg.names)
+}
+
+// FindAll returns up to @n matches
+//
+// @n: the max number of matches to return, or -1 to return all matches
+func (reg *Regexp) FindAll(str []byte, n int) []*Match {
+	res := []*Match{}
+	it := reg.Matches(str)
+	for (n < 0 || len(res) < n) && it.Next() {
+		res = append(res, it.Match())
+	}
+	return res
+}
+
+// FindIndex returns the start and end offsets of the first match, or nil if there is no match
+func (reg *Regexp) FindIndex(str []byte) []int {
+	ind, _ := reg.findAt(str, 0, 0)
+	if ind == nil {
+		return nil
+	}
+	return ind[:2]
+}
+
+// FindSubmatch returns the first match followed by its capture groups, or nil if there is no match
+func (reg *Regexp) FindSubmatch(str []byte) [][]byte {
+	if m := reg.Find(str); m != nil {
+		return m.Submatch()
+	}
+	return nil
+}
+
+//* RE2 find methods
+
+// Find returns the first match, or nil if there is no match
+func (reg *RegexpRE2) Find(str []byte) *Match {
+	ind := reg.RE.FindSubmatchIndex(str)
+	if ind == nil {
+		return nil
+	}
+	return newMatch(str, ind, reg.RE.SubexpNames())
+}
+
+// FindAll returns up to @n matches
+//
+// @n: the max number of matches to return, or -1 to return all matches
+func (reg *RegexpRE2) FindAll(str []byte, n int) []*Match {
+	res := []*Match{}
+	for _, ind := range reg.RE.FindAllSubmatchIndex(str, n) {
+		res = append(res, newMatch(str, ind, reg.RE.SubexpNames()))
+	}
+	return res
+}
+
+// FindIndex returns the start and end offsets of the first match, or nil if there is no match
+func (reg *RegexpRE2) FindIndex(str []byte) []int {
+	return reg.RE.FindIndex(str)
+}
+
+// FindSubmatch returns the first match followed by its capture groups, or nil if there is no match
+func (reg *RegexpRE2) FindSubmatch(str []byte) [][]byte {
+	if m := reg.Find(str); m != nil {
+		return m.Submatch()
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package regex
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+)
+
+// FileMatch is a match found by FindAllFile or FindAllReader
+type FileMatch struct {
+	// Match has the full match and its capture groups
+	//
+	// m.Input only has the part of the input used by the match, so Start and End are not offsets in the file
+	*Match
+
+	// Offset is the byte offset of the match in the file
+	Offset int64
+
+	// Line is the line number of the start of the match (starting at 1)
+	Line int
+
+	// Column is the byte column of the start of the match in its line (starting at 1)
+	Column int
+
+	// Text has the full lines of the match, from the start of its first line to the end of its last line (without the newline)
+	Text []byte
+
+	// Before has up to @contextLines lines before the line of the match (without the newline)
+	Before [][]byte
+
+	// After has up to @contextLines lines after the last line of the match (without the newline)
+	After [][]byte
+}
+
+//* PCRE find file methods
+
+// FindAllFile returns every match in a file, with its offset, line and column
+//
+// the file is read once through a sliding window (see MatchReader)
+//
+// @contextLines: the number of lines to keep before and after each match (like grep -C)
+func (reg *Regexp) FindAllFile(file *os.File, contextLines int, maxReSize ...int64) ([]*FileMatch, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return findAllStream(context.Background(), reg, io.NewSectionReader(file, 0, info.Size()), int(fileWindow(reg.len, maxReSize)), contextLines)
+}
+
+// FindAllReader returns every match in @r, with its offset, line and column
+//
+// the input is read once through a sliding window (see MatchReader)
+//
+// @contextLines: the number of lines to keep before and after each match (like grep -C)
+func (reg *Regexp) FindAllReader(r io.Reader, contextLines int, maxReSize ...int64) ([]*FileMatch, error) {
+	return findAllStream(context.Background(), reg, r, int(fileWindow(reg.len, maxReSize)), contextLines)
+}
+
+//* RE2 find file methods
+
+// FindAllFile returns every match in a file, with its offset, line and column
+//
+// the file is read once through a sliding window (see MatchReader)
+//
+// @contextLines: the number of lines to keep before and after each match (like grep -C)
+func (reg *RegexpRE2) FindAllFile(file *os.File, contextLines int, maxReSize ...int64) ([]*FileMatch, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return findAllStream(context.Background(), reg, io.NewSectionReader(file, 0, info.Size()), int(fileWindow(reg.len, maxReSize)), contextLines)
+}
+
+// FindAllReader returns every match in @r, with its offset, line and column
+//
+// the input is read once through a sliding window (see MatchReader)
+//
+// @contextLines: the number of lines to keep before and after each match (like grep -C)
+func (reg *RegexpRE2) FindAllReader(r io.Reader, contextLines int, maxReSize ...int64) ([]*FileMatch, error) {
+	return findAllStream(context.Background(), reg, r, int(fileWindow(reg.len, maxReSize)), contextLines)
+}
+
+//* shared find file methods
+
+// findAllStream returns every match in @src, with its offset, line, column and context lines
+func findAllStream(ctx context.Context, reg matcher, src io.Reader, window int, contextLines int) ([]*FileMatch, error) {
+	res := []*FileMatch{}
+	lines := &lineTracker{line: 1, n: max(contextLines, 0)}
+
+	err := scanStream(ctx, reg, src, window, func(m *Match, base int64) bool {
+		lines.read(m.Input[lines.pos-base : m.Start()])
+
+		fm := &FileMatch{Offset: base + int64(m.Start()), Line: lines.line}
+		fm.Column = int(fm.Offset-lines.lineStart) + 1
+		fm.Match, _ = m.detach(base)
+
+		if lines.n > 0 {
+			fm.Before = append([][]byte{}, lines.before...)
+		}
+		lines.pending = append(lines.pending, pendingLines{fm, max(fm.Offset, base+int64(m.End())-1)})
+
+		res = append(res, fm)
+		return true
+	}, func(b []byte, base int64) {
+		lines.read(b[lines.pos-base:])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lines.close()
+	return res, nil
+}
+
+// lineTracker counts the lines of a stream, and keeps the context lines of the matches
+type lineTracker struct {
+	// pos is the offset of the next byte to read
+	pos int64
+
+	// line is the line number at pos, and lineStart is the offset where that line starts
+	line      int
+	lineStart int64
+
+	// n is the number of context lines to keep
+	n int
+
+	// partial is the text of the current line up to pos
+	partial []byte
+	before  [][]byte
+	pending []pendingLines
+}
+
+// pendingLines is a match that still needs the rest of its lines, or lines after it
+type pendingLines struct {
+	m *FileMatch
+
+	// last is the offset of the last byte of the match
+	last int64
+}
+
+// read counts the lines in @b, which must start at the offset pos
+func (lt *lineTracker) read(b []byte) {
+	for len(b) != 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i == -1 {
+			lt.partial = append(lt.partial, b...)
+			lt.pos += int64(len(b))
+			return
+		}
+
+		lt.partial = append(lt.partial, b[:i]...)
+		lt.endLine()
+
+		lt.pos += int64(i + 1)
+		lt.line++
+		lt.lineStart = lt.pos
+		b = b[i+1:]
+	}
+}
+
+// endLine adds the current line to the text and context lines of the matches
+func (lt *lineTracker) endLine() {
+	line := lt.partial
+	lt.partial = nil
+
+	pending := lt.pending[:0]
+	for _, p := range lt.pending {
+		if lt.lineStart > p.last {
+			p.m.After = append(p.m.After, line)
+		} else {
+			if lt.lineStart > p.m.Offset {
+				p.m.Text = append(p.m.Text, '\n')
+			}
+			p.m.Text = append(p.m.Text, line...)
+		}
+
+		// the match still needs its next line, or more lines after it
+		if lt.lineStart+int64(len(line)) < p.last || len(p.m.After) < lt.n {
+			pending = append(pending, p)
+		}
+	}
+	lt.pending = pending
+
+	if lt.n > 0 {
+		lt.before = append(lt.before, line)
+		if len(lt.before) > lt.n {
+			lt.before = append(lt.before[:0], lt.before[1:]...)
+		}
+	}
+}
+
+// close ends the last line, if it does not end with a newline
+func (lt *lineTracker) close() {
+	if lt.pos > lt.lineStart {
+		lt.endLine()
+	}
+}
@@ -1,6 +1,7 @@
 package regex
 
 import (
+	"context"
 	"io"
 	"os"
 )
@@ -29,6 +30,11 @@ func (reg *Regexp) RepFileStr(file *os.File, rep []byte, all bool, maxReSize ...
 	buf = buf[:size]
 	for err == nil {
 		if reg.Match(buf) {
+			if !found {
+				if err := backupFile(file); err != nil {
+					return err
+				}
+			}
 			found = true
 
 			repRes := reg.RepStr(buf, rep)
@@ -108,6 +114,11 @@ func (reg *Regexp) RepFileStr(file *os.File, rep []byte, all bool, maxReSize ...
 	}
 
 	if reg.Match(buf) {
+		if !found {
+			if err := backupFile(file); err != nil {
+				return err
+			}
+		}
 		found = true
 
 		repRes := reg.RepStr(buf, rep)
@@ -205,6 +216,11 @@ func (reg *Regexp) RepFileFunc(file *os.File, rep func(data func(int) []byte) []
 	buf = buf[:size]
 	for err == nil {
 		if reg.Match(buf) {
+			if !found {
+				if err := backupFile(file); err != nil {
+					return err
+				}
+			}
 			found = true
 
 			repRes := reg.RepFunc(buf, rep)
@@ -284,6 +300,11 @@ func (reg *Regexp) RepFileFunc(file *os.File, rep func(data func(int) []byte) []
 	}
 
 	if reg.Match(buf) {
+		if !found {
+			if err := backupFile(file); err != nil {
+				return err
+			}
+		}
 		found = true
 
 		repRes := reg.RepFunc(buf, rep)
@@ -358,32 +379,9 @@ func (reg *Regexp) RepFileFunc(file *os.File, rep func(data func(int) []byte) []
 }
 
 // MatchFile returns true if a file contains a regex match
+//
+// the file is read once through a sliding window (see MatchReader)
 func (reg *Regexp) MatchFile(file *os.File, maxReSize ...int64) bool {
-	l := int64(reg.len * 10)
-	if l < 1024 {
-		l = 1024
-	}
-	for _, maxRe := range maxReSize {
-		if l < maxRe {
-			l = maxRe
-		}
-	}
-
-	i := int64(0)
-
-	buf := make([]byte, l)
-	size, err := file.ReadAt(buf, i)
-	buf = buf[:size]
-	for err == nil {
-		if reg.Match(buf) {
-			return true
-		}
-
-		i++
-		buf = make([]byte, l)
-		size, err = file.ReadAt(buf, i)
-		buf = buf[:size]
-	}
-
-	return reg.Match(buf)
+	ok, _ := matchFileCtx(context.Background(), reg, file, fileWindow(reg.len, maxReSize))
+	return ok
 }
@@ -0,0 +1,132 @@
+package regex
+
+import "unsafe"
+
+// Text is a string or []byte
+type Text interface {
+	string | []byte
+}
+
+// Finder is an Engine that also has the Find methods
+//
+// both *Regexp (PCRE) and *RegexpRE2 implement this interface
+type Finder interface {
+	Engine
+	Find(str []byte) *Match
+	FindAll(str []byte, n int) []*Match
+	FindIndex(str []byte) []int
+	FindSubmatch(str []byte) [][]byte
+}
+
+var _ Finder = (*Regexp)(nil)
+var _ Finder = (*RegexpRE2)(nil)
+
+// toBytes returns the []byte of a string or []byte
+//
+// a string is not copied, so the result must never be modified
+//
+// an empty string returns an empty slice instead of nil, because nil stops the replacements in RepFunc
+func toBytes[T Text](str T) []byte {
+	if s, ok := any(str).(string); ok {
+		if len(s) == 0 {
+			return []byte{}
+		}
+		return unsafe.Slice(unsafe.StringData(s), len(s))
+	}
+	return []byte(str)
+}
+
+// fromBytes returns a string or []byte from a []byte
+//
+// a string is not copied, so @b must never be modified after this call
+// (the results of the regex methods are either new or part of the input)
+func fromBytes[T Text](b []byte) T {
+	var t T
+	if _, ok := any(t).(string); ok {
+		return T(unsafe.String(unsafe.SliceData(b), len(b)))
+	}
+	return T(b)
+}
+
+// IsMatch returns true if a string or []byte matches a regex
+//
+// this is the same as reg.Match, but also accepts a string without copying it
+func IsMatch[T Text](reg Engine, str T) bool {
+	return reg.Match(toBytes(str))
+}
+
+// Split is the same as reg.Split, but also accepts and returns a string without copying it
+func Split[T Text](reg Engine, str T) []T {
+	res := reg.Split(toBytes(str))
+
+	list := make([]T, len(res))
+	for i, b := range res {
+		list[i] = fromBytes[T](b)
+	}
+	return list
+}
+
+// RepStr is the same as reg.RepStr, but also accepts and returns a string without extra copies
+func RepStr[T Text](reg Engine, str T, rep T) T {
+	return fromBytes[T](reg.RepStr(toBytes(str), toBytes(rep)))
+}
+
+// RepStrLit is the same as reg.RepStrLit, but also accepts and returns a string without extra copies
+func RepStrLit[T Text](reg Engine, str T, rep T) T {
+	return fromBytes[T](reg.RepStrLit(toBytes(str), toBytes(rep)))
+}
+
+// RepFunc is the same as reg.RepFunc, but also accepts and returns a string without extra copies
+//
+// note: a string cannot be nil, so returning nil to stop the loop early only works with []byte
+func RepFunc[T Text](reg Engine, str T, rep func(data func(int) T) T, blank ...bool) T {
+	return fromBytes[T](reg.RepFunc(toBytes(str), func(data func(int) []byte) []byte {
+		return toBytes(rep(func(g int) T {
+			return fromBytes[T](data(g))
+		}))
+	}, blank...))
+}
+
+// Find returns the first match of a string or []byte, and false if there is no match
+func Find[T Text](reg Finder, str T) (T, bool) {
+	if m := reg.Find(toBytes(str)); m != nil {
+		return fromBytes[T](m.Bytes()), true
+	}
+
+	var t T
+	return t, false
+}
+
+// FindAll returns up to @n matches of a string or []byte
+//
+// @n: the max number of matches to return, or -1 to return all matches
+func FindAll[T Text](reg Finder, str T, n int) []T {
+	res := reg.FindAll(toBytes(str), n)
+
+	list := make([]T, len(res))
+	for i, m := range res {
+		list[i] = fromBytes[T](m.Bytes())
+	}
+	return list
+}
+
+// FindIndex returns the start and end offsets of the first match of a string or []byte, or nil if there is no match
+func FindIndex[T Text](reg Finder, str T) []int {
+	return reg.FindIndex(toBytes(str))
+}
+
+// FindSubmatch returns the first match of a string or []byte followed by its capture groups, or nil if there is no match
+//
+// capture groups that did not take part in the match are empty
+func FindSubmatch[T Text](reg Finder, str T) []T {
+	res := reg.FindSubmatch(toBytes(str))
+	if res == nil {
+		return nil
+	}
+
+	list := make([]T, len(res))
+	for i, b := range res {
+		list[i] = fromBytes[T](b)
+	}
+	return list
+}
@@ -0,0 +1,246 @@
+package regex
+
+import (
+	"context"
+	"regexp"
+	"unicode/utf8"
+)
+
+// MatchIter finds the matches of a regex one at a time
+//
+// use Matches to create a new iterator
+type MatchIter struct {
+	str   []byte
+	names []string
+	next  func() ([]int, error)
+	match *Match
+	err   error
+	ctx   context.Context
+}
+
+// Next finds the next match, and returns false if there are no more matches
+//
+// it also returns false if the regex failed to match, use Err to check for an error
+func (it *MatchIter) Next() bool {
+	if it.next == nil {
+		return false
+	}
+
+	if it.ctx != nil {
+		if err := it.ctx.Err(); err != nil {
+			it.next = nil
+			it.match = nil
+			it.err = err
+			return false
+		}
+	}
+
+	ind, err := it.next()
+	if ind == nil {
+		it.next = nil
+		it.match = nil
+		it.err = err
+		return false
+	}
+
+	it.match = newMatch(it.str, ind, it.names)
+	return true
+}
+
+// Match returns the current match
+func (it *MatchIter) Match() *Match {
+	return it.match
+}
+
+// Err returns the error that stopped the iterator, or nil if it stopped because there were no more matches
+//
+// ie: ErrMatchLimit when a PCRE regex reached its backtracking limit, or ctx.Err() when the context was canceled
+func (it *MatchIter) Err() error {
+	return it.err
+}
+
+// withContext makes the iterator stop with ctx.Err() once the context is canceled
+func (it *MatchIter) withContext(ctx context.Context) *MatchIter {
+	it.ctx = ctx
+	return it
+}
+
+// Matches returns an iterator that finds one match at a time
+//
+// nothing is searched until Next is called, so breaking out of the loop early skips the rest of the input
+//
+//	it := reg.Matches(buf)
+//	for it.Next() {
+//		m := it.Match()
+//	}
+func (reg *Regexp) Matches(str []byte) *MatchIter {
+	return reg.matches(str, 0)
+}
+
+// matches returns an iterator that passes extra match flags to PCRE (ie: NOTBOL)
+func (reg *Regexp) matches(str []byte, flags int) *MatchIter {
+	return reg.matchesFrom(str, 0, flags)
+}
+
+// matchesFrom returns an iterator that starts searching at @pos, for the matcher interface
+//
+// str[:pos] is only used as the text before the input (ie: for ^, \b and lookbehind)
+func (reg *Regexp) matchesFrom(str []byte, pos int, flags int) *MatchIter {
+	prevEnd := -1
+
+	return &MatchIter{str: str, names: reg.names, next: func() ([]int, error) {
+		for pos <= len(str) {
+			ind, err := reg.findAt(str, pos, flags)
+			if ind == nil {
+				pos = len(str) + 1
+				return nil, err
+			}
+
+			if ind[0] == ind[1] {
+				// advance by one char to avoid matching the same empty string forever
+				_, w := utf8.DecodeRune(str[ind[1]:])
+				pos = ind[1] + max(w, 1)
+
+				// an empty match directly after the previous match is skipped, the same as the RE2 methods
+				if ind[0] == prevEnd {
+					continue
+				}
+			} else {
+				pos = ind[1]
+			}
+
+			prevEnd = ind[1]
+			return ind, nil
+		}
+		return nil, nil
+	}}
+}
+
+// Matches returns an iterator that finds one match at a time
+//
+// nothing is searched until Next is called, so breaking out of the loop early skips the rest of the input
+//
+// note: the builtin RE2 module cannot resume a search from an offset,
+// so matches are found in batches that double in size, which keeps the amount of work
+// within 2x of what was actually used
+//
+//	it := reg.Matches(buf)
+//	for it.Next() {
+//		m := it.Match()
+//	}
+func (reg *RegexpRE2) Matches(str []byte) *MatchIter {
+	return reg.matches(str, 0)
+}
+
+// matches returns an iterator for the matcher interface
+//
+// RE2 does not support match flags, so they are ignored
+func (reg *RegexpRE2) matches(str []byte, flags int) *MatchIter {
+	batch := [][]int{}
+	found := 0
+	size := 0
+	done := false
+
+	return &MatchIter{str: str, names: reg.RE.SubexpNames(), next: func() ([]int, error) {
+		if len(batch) == 0 {
+			if done {
+				return nil, nil
+			}
+
+			size = max(size*2, 8)
+			all := reg.RE.FindAllSubmatchIndex(str, size)
+			if len(all) < size {
+				done = true
+			}
+			batch = all[found:]
+			found = len(all)
+
+			if len(batch) == 0 {
+				return nil, nil
+			}
+		}
+
+		ind := batch[0]
+		batch = batch[1:]
+		return ind, nil
+	}}
+}
+
+// matchesFrom returns an iterator that starts searching at @pos, for the matcher interface
+//
+// str[:pos] is only used as the text before the input (ie: for ^ and \b)
+func (reg *RegexpRE2) matchesFrom(str []byte, pos int, flags int) *MatchIter {
+	after := reg.afterRE()
+	if pos == 0 || after == nil {
+		it := reg.matches(str[pos:], flags)
+		return &MatchIter{str: str, names: it.names, next: func() ([]int, error) {
+			if !it.Next() {
+				return nil, it.Err()
+			}
+			return shiftIndex(it.Match().Index, pos), nil
+		}}
+	}
+
+	prevEnd := -1
+
+	return &MatchIter{str: str, names: reg.RE.SubexpNames(), next: func() ([]int, error) {
+		for pos <= len(str) {
+			// the search starts one char before @pos, which is matched by the prefix of the regex
+			_, w := utf8.DecodeLastRune(str[:pos])
+			ind := after.FindSubmatchIndex(str[pos-w:])
+			if ind == nil {
+				pos = len(str) + 1
+				return nil, nil
+			}
+			ind = shiftIndex(ind[2:], pos-w)
+
+			if ind[0] == ind[1] {
+				// advance by one char to avoid matching the same empty string forever
+				_, w := utf8.DecodeRune(str[ind[1]:])
+				pos = ind[1] + max(w, 1)
+
+				// an empty match directly after the previous match is skipped, the same as FindAll
+				if ind[0] == prevEnd {
+					continue
+				}
+			} else {
+				pos = ind[1]
+			}
+
+			prevEnd = ind[1]
+			return ind, nil
+		}
+		return nil, nil
+	}}
+}
+
+// afterRE returns the regex used by matchesFrom, which skips the first char,
+// and then finds the regex in group 1 at the first place it matches
+//
+// returns nil if the regex could not be compiled
+func (reg *RegexpRE2) afterRE() *regexp.Regexp {
+	if re := reg.after.Load(); re != nil {
+		return re
+	}
+
+	re, err := regexp.Compile(`\A(?s:.)(?s:.*?)(` + reg.RE.String() + `)`)
+	if err != nil {
+		return nil
+	}
+	reg.after.Store(re)
+	return re
+}
+
+//* shared iterator methods
+
+// shiftIndex adds @n to every group offset that is set
+func shiftIndex(ind []int, n int) []int {
+	res := make([]int, len(ind))
+	for i, v := range ind {
+		if v >= 0 {
+			v += n
+		}
+		res[i] = v
+	}
+	return res
+}
@@ -0,0 +1,75 @@
+package regex
+
+import (
+	"sync/atomic"
+
+	"github.com/GRbit/go-pcre"
+)
+
+var jitAll atomic.Bool
+var jitThreshold atomic.Int64
+
+// SetJIT enables or disables JIT compilation for every PCRE regex compiled after this call
+//
+// JIT makes compiling slower, but matching a lot faster
+func SetJIT(enabled bool) {
+	jitAll.Store(enabled)
+}
+
+// SetJITThreshold recompiles a PCRE regex with JIT after it has been used more than @n times
+//
+// this gives long running services the speed of JIT on their hot patterns,
+// without paying for JIT on patterns that are only used once
+//
+// @n: 0 disables automatic JIT compilation (default: 0)
+func SetJITThreshold(n int64) {
+	jitThreshold.Store(n)
+}
+
+// JIT returns true if the regex is being matched with a JIT compiled version
+func (reg *Regexp) JIT() bool {
+	return reg.jit.Load() != nil
+}
+
+// re returns the compiled regex that should be used for matching
+//
+// this also counts uses and promotes the regex to JIT once it passes the threshold
+func (reg *Regexp) re() *pcre.Regexp {
+	if jit := reg.jit.Load(); jit != nil {
+		return jit
+	}
+
+	if n := jitThreshold.Load(); n > 0 && !reg.jitDone.Load() && reg.uses.Add(1) > n {
+		reg.compJIT()
+		if jit := reg.jit.Load(); jit != nil {
+			return jit
+		}
+	}
+
+	return &reg.RE
+}
+
+// compJIT recompiles the regex with STUDY_JIT_COMPILE
+//
+// this only runs once per regex, and if JIT fails (ie: the PCRE library was built without JIT support),
+// the regex keeps using the normal compiled version
+//
+// note: the RE field is left unchanged, so it is safe to read while other goroutines are matching
+func (reg *Regexp) compJIT() {
+	if !reg.jitDone.CompareAndSwap(false, true) {
+		return
+	}
+
+	re, err := pcre.CompileJIT(reg.expr, reg.cflags, pcre.STUDY_JIT_COMPILE)
+	if err != nil {
+		return
+	}
+
+	assignJITStack(&re)
+	reg.jit.Store(&re)
+
+	// the JIT copy adds to the memory used by the regex
+	if reg.key != "" {
+		cache.Resize(reg.key)
+	}
+}
@@ -0,0 +1,100 @@
+package regex
+
+/*
+#cgo pkg-config: libpcre
+#include <pcre.h>
+#include <pthread.h>
+#include <stdlib.h>
+
+static int goregex_jit_stack_max = 0;
+
+// the stack of each thread is kept in a thread key, so it is freed when the thread exits
+static pthread_key_t goregex_jit_stack_key;
+static pthread_once_t goregex_jit_stack_once = PTHREAD_ONCE_INIT;
+
+// goregex_jit_stack is the JIT stack of a thread, with the max size it was made with
+typedef struct {
+	pcre_jit_stack *stack;
+	int size;
+} goregex_jit_stack;
+
+static void goregex_free_jit_stack(void *data) {
+	goregex_jit_stack *s = (goregex_jit_stack *)data;
+	if (s->stack != NULL) {
+		pcre_jit_stack_free(s->stack);
+	}
+	free(s);
+}
+
+static void goregex_init_jit_stack_key(void) {
+	pthread_key_create(&goregex_jit_stack_key, goregex_free_jit_stack);
+}
+
+// a JIT stack must never be used by two matches at the same time,
+// so every thread gets its own stack (a cgo call always runs on a single thread)
+//
+// when the max size changes, the old stack of the thread is freed the next time it runs a JIT match
+static pcre_jit_stack *goregex_jit_callback(void *data) {
+	int size = __atomic_load_n(&goregex_jit_stack_max, __ATOMIC_RELAXED);
+
+	goregex_jit_stack *s = (goregex_jit_stack *)pthread_getspecific(goregex_jit_stack_key);
+	if (s == NULL) {
+		if (size <= 0) {
+			return NULL;
+		}
+		s = (goregex_jit_stack *)calloc(1, sizeof(goregex_jit_stack));
+		if (s == NULL || pthread_setspecific(goregex_jit_stack_key, s) != 0) {
+			free(s);
+			return NULL;
+		}
+	}
+
+	if (s->size != size) {
+		if (s->stack != NULL) {
+			pcre_jit_stack_free(s->stack);
+			s->stack = NULL;
+		}
+		s->size = 0;
+
+		if (size > 0) {
+			s->stack = pcre_jit_stack_alloc(size < 32 * 1024 ? size : 32 * 1024, size);
+			s->size = s->stack == NULL ? 0 : size;
+		}
+	}
+
+	// NULL uses the default 32K machine stack
+	return s->stack;
+}
+
+static void goregex_set_jit_stack_max(int size) {
+	pthread_once(&goregex_jit_stack_once, goregex_init_jit_stack_key);
+	__atomic_store_n(&goregex_jit_stack_max, size, __ATOMIC_RELAXED);
+}
+
+static void goregex_assign_jit_stack(void *extra) {
+	pthread_once(&goregex_jit_stack_once, goregex_init_jit_stack_key);
+	pcre_assign_jit_stack((pcre_extra *)extra, goregex_jit_callback, NULL);
+}
+*/
+import "C"
+
+import "github.com/GRbit/go-pcre"
+
+// SetJITStackSize sets the max size in bytes of the stack used by JIT compiled regex
+//
+// a larger stack lets complex patterns match long inputs, instead of failing with a JIT stack limit error
+//
+// @size: 0 uses the default 32K machine stack (default: 0)
+func SetJITStackSize(size int) {
+	C.goregex_set_jit_stack_max(C.int(size))
+}
+
+// assignJITStack makes a JIT compiled regex use the stack set by SetJITStackSize
+//
+// note: go-pcre does not expose pcre_extra, so it is read from the unexported field (see pcreField),
+// and if that field cannot be read, the regex keeps the default 32K machine stack
+func assignJITStack(re *pcre.Regexp) {
+	if extra := pcreField(re, "extra"); extra != nil {
+		C.goregex_assign_jit_stack(extra)
+	}
+}
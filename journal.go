@@ -0,0 +1,296 @@
+package regex
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// journalManifest is the name of the file in a journal that lists the backups
+const journalManifest = "journal.jsonl"
+
+// Journal keeps a backup of every file before a file method changes it, so the changes can be undone
+//
+// a journal is a directory with a copy of each file, and the original path and mode of each copy
+type Journal struct {
+	id  string
+	dir string
+
+	mu    sync.Mutex
+	files map[string]bool
+	list  []journalEntry
+	next  int
+}
+
+// journalEntry is one line of the journal manifest
+type journalEntry struct {
+	Path   string      `json:"path"`
+	Backup string      `json:"backup"`
+	Mode   os.FileMode `json:"mode"`
+}
+
+var defaultJournal atomic.Pointer[Journal]
+
+// SetJournal sets a journal for every file method that does not have one in its options
+//
+// this includes RepFileStr and RepFileFunc, which do not have options
+//
+// @j: nil to stop using a journal
+func SetJournal(j *Journal) {
+	defaultJournal.Store(j)
+}
+
+// journalFor returns the journal of the options, or the default journal
+func journalFor(j *Journal) *Journal {
+	if j != nil {
+		return j
+	}
+	return defaultJournal.Load()
+}
+
+// NewJournal creates a new journal in @dir (ie: .goregex-journal)
+//
+// each journal gets its own directory inside @dir, named by its ID
+func NewJournal(dir string) (*Journal, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	id := time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+
+	if err := os.MkdirAll(filepath.Join(dir, id), 0700); err != nil {
+		return nil, err
+	}
+
+	return &Journal{id: id, dir: filepath.Join(dir, id), files: map[string]bool{}}, nil
+}
+
+// OpenJournal opens a journal that was created by NewJournal
+func OpenJournal(dir string, id string) (*Journal, error) {
+	j := &Journal{id: id, dir: filepath.Join(dir, id), files: map[string]bool{}}
+
+	file, err := os.Open(filepath.Join(j.dir, journalManifest))
+	if errors.Is(err, os.ErrNotExist) {
+		// the journal exists, but nothing was backed up yet
+		if _, err := os.Stat(j.dir); err != nil {
+			return nil, err
+		}
+		return j, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// a line can only be broken if the process died while writing it, so its backup is not needed
+			continue
+		}
+		j.files[e.Path] = true
+		j.list = append(j.list, e)
+		if n, err := strconv.Atoi(e.Backup); err == nil && n > j.next {
+			j.next = n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Undo restores every file in a journal, and removes the journal (see Journal.Undo)
+func Undo(dir string, id string) error {
+	j, err := OpenJournal(dir, id)
+	if err != nil {
+		return err
+	}
+	return j.Undo()
+}
+
+// ID returns the ID of the journal, for Undo and OpenJournal
+func (j *Journal) ID() string {
+	return j.id
+}
+
+// Files returns the paths of the files in the journal
+func (j *Journal) Files() []string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	res := make([]string, len(j.list))
+	for i, e := range j.list {
+		res[i] = e.Path
+	}
+	return res
+}
+
+// Backup adds a copy of a file to the journal
+//
+// only the first backup of a path is kept, so Undo restores the file from before the first change
+func (j *Journal) Backup(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return j.backup(file)
+}
+
+// backup adds a copy of an open file to the journal
+func (j *Journal) backup(file *os.File) error {
+	path, err := filepath.Abs(file.Name())
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	if j.files[path] {
+		j.mu.Unlock()
+		return nil
+	}
+	j.files[path] = true
+	j.next++
+	name := strconv.Itoa(j.next)
+	j.mu.Unlock()
+
+	e := journalEntry{Path: path, Backup: name, Mode: info.Mode()}
+	if err := j.copy(file, info.Size(), e); err != nil {
+		j.mu.Lock()
+		delete(j.files, path)
+		j.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// copy writes the backup of a file, and then adds it to the manifest
+//
+// the backup is synced before the manifest, so the manifest never lists a backup that is not complete
+func (j *Journal) copy(file *os.File, size int64, e journalEntry) error {
+	dst, err := os.OpenFile(filepath.Join(j.dir, e.Backup), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, io.NewSectionReader(file, 0, size)); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	manifest, err := os.OpenFile(filepath.Join(j.dir, journalManifest), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+
+	if _, err := manifest.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := manifest.Sync(); err != nil {
+		return err
+	}
+
+	j.list = append(j.list, e)
+	return nil
+}
+
+// Undo restores every file in the journal to the content it had before the first change, and removes the journal
+//
+// each file is restored atomically (see RepFileStrAtomic), and if a file cannot be restored,
+// the other files are still restored and the journal is kept, so Undo can be run again
+func (j *Journal) Undo() error {
+	j.mu.Lock()
+	list := append([]journalEntry{}, j.list...)
+	j.mu.Unlock()
+
+	errs := []error{}
+	for _, e := range list {
+		if err := restoreFile(e.Path, filepath.Join(j.dir, e.Backup), e.Mode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+
+	return os.RemoveAll(j.dir)
+}
+
+// restoreFile replaces a file with its backup
+func restoreFile(path string, backup string, mode os.FileMode) error {
+	src, err := os.Open(backup)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".goregex-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		return err
+	}
+	// keep the owner of the file where it is allowed, and set it before the mode, since chown clears the setuid and setgid bits
+	if info, err := os.Stat(path); err == nil {
+		if err := chownLike(tmp, info); err != nil && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+	}
+	if err := tmp.Chmod(mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// backupFile adds a file to the default journal, if there is one
+func backupFile(file *os.File) error {
+	if j := defaultJournal.Load(); j != nil {
+		return j.backup(file)
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package regex
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/GRbit/go-pcre"
+)
+
+// ErrMatchLimit is returned when a PCRE regex reaches its backtracking (match) limit
+var ErrMatchLimit = errors.New("regex: match limit reached")
+
+// ErrRecursionLimit is returned when a PCRE regex reaches its recursion depth limit
+var ErrRecursionLimit = errors.New("regex: recursion limit reached")
+
+// ErrJITStackLimit is returned when a JIT compiled PCRE regex runs out of stack (see SetJITStackSize)
+var ErrJITStackLimit = errors.New("regex: JIT stack limit reached")
+
+var matchLimit atomic.Int64
+var recursionLimit atomic.Int64
+
+// SetMatchLimit sets the default backtracking limit for every PCRE regex compiled after this call
+//
+// a regex that reaches the limit stops matching, and the Try methods return ErrMatchLimit
+//
+// @n: 0 uses the default limit of the PCRE library (usually 10000000)
+func SetMatchLimit(n int) {
+	matchLimit.Store(int64(n))
+}
+
+// SetRecursionLimit sets the default recursion depth limit for every PCRE regex compiled after this call
+//
+// a regex that reaches the limit stops matching, and the Try methods return ErrRecursionLimit
+//
+// note: JIT compiled regex ignore this limit
+//
+// @n: 0 uses the default limit of the PCRE library
+func SetRecursionLimit(n int) {
+	recursionLimit.Store(int64(n))
+}
+
+// limitPrefix returns the (*LIMIT_MATCH=n) and (*LIMIT_RECURSION=n) start of pattern items for the options
+//
+// note: go-pcre does not expose pcre_extra, so the limits are set inside the regex,
+// which can only lower the limits of the PCRE library, and needs PCRE 8.33 or newer
+func (opts Options) limitPrefix() string {
+	prefix := ""
+	if opts.MatchLimit > 0 {
+		prefix += "(*LIMIT_MATCH=" + strconv.Itoa(opts.MatchLimit) + ")"
+	}
+	if opts.RecursionLimit > 0 {
+		prefix += "(*LIMIT_RECURSION=" + strconv.Itoa(opts.RecursionLimit) + ")"
+	}
+	return prefix
+}
+
+// execError returns the error of a failed pcre_exec call
+//
+// go-pcre only reports the error as text, so the error code is read from the start of it (ie: "-8, pcre_exec: ...")
+// instead of running the match again
+func execError(err error) error {
+	code, _, ok := strings.Cut(err.Error(), ",")
+	if !ok {
+		return err
+	}
+	rc, e := strconv.Atoi(code)
+	if e != nil {
+		return err
+	}
+
+	if e := limitError(rc); e != nil {
+		return e
+	}
+	return err
+}
+
+// limitError returns the error of a pcre_exec return code that means a limit was reached, or nil for any other code
+func limitError(rc int) error {
+	switch rc {
+	case pcre.ERROR_MATCHLIMIT:
+		return ErrMatchLimit
+	case pcre.ERROR_RECURSIONLIMIT:
+		return ErrRecursionLimit
+	case pcre.ERROR_JIT_STACKLIMIT:
+		return ErrJITStackLimit
+	}
+	return nil
+}
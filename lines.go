@@ -0,0 +1,183 @@
+package regex
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+//* PCRE line methods
+
+// MatchLines runs the regex on each line of @r, and returns the line numbers that have a match
+//
+// the line ending (\n or \r\n) is not part of the line, so ^ and $ always match at the start and end of the line,
+// instead of at the edges of a fixed size window like MatchFile
+//
+// @block: the number of lines to match at once (default: 1)
+// the line endings inside a block are kept, and the line number of the first line of each block is returned
+func (reg *Regexp) MatchLines(r io.Reader, block ...int) ([]int, error) {
+	return matchLines(reg, r, block)
+}
+
+// RepLines copies @src to @dst, and replaces every match in each line the same way as RepStr
+//
+// every line ending (\n or \r\n) is written exactly as it was read, and a missing newline at the end stays missing
+//
+// returns the line numbers of the lines that changed
+//
+// @block: the number of lines to replace at once (default: 1)
+// the line endings inside a block are kept, and the line number of the first line of each block is returned
+func (reg *Regexp) RepLines(dst io.Writer, src io.Reader, rep []byte, block ...int) ([]int, error) {
+	return repLines(reg, dst, src, block, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepLinesFunc copies @src to @dst, and replaces every match in each line with the result of a function, the same as RepFunc
+//
+// returning nil from @rep stops replacing in the current line
+//
+// returns the line numbers of the lines that changed
+//
+// @block: the number of lines to replace at once (default: 1)
+func (reg *Regexp) RepLinesFunc(dst io.Writer, src io.Reader, rep func(data func(int) []byte) []byte, block ...int) ([]int, error) {
+	return repLines(reg, dst, src, block, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+//* RE2 line methods
+
+// MatchLines runs the regex on each line of @r, and returns the line numbers that have a match
+//
+// the line ending (\n or \r\n) is not part of the line, so ^ and $ always match at the start and end of the line,
+// instead of at the edges of a fixed size window like MatchFile
+//
+// @block: the number of lines to match at once (default: 1)
+// the line endings inside a block are kept, and the line number of the first line of each block is returned
+func (reg *RegexpRE2) MatchLines(r io.Reader, block ...int) ([]int, error) {
+	return matchLines(reg, r, block)
+}
+
+// RepLines copies @src to @dst, and replaces every match in each line the same way as RepStr
+//
+// every line ending (\n or \r\n) is written exactly as it was read, and a missing newline at the end stays missing
+//
+// returns the line numbers of the lines that changed
+//
+// @block: the number of lines to replace at once (default: 1)
+// the line endings inside a block are kept, and the line number of the first line of each block is returned
+func (reg *RegexpRE2) RepLines(dst io.Writer, src io.Reader, rep []byte, block ...int) ([]int, error) {
+	return repLines(reg, dst, src, block, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepLinesFunc copies @src to @dst, and replaces every match in each line with the result of a function, the same as RepFunc
+//
+// returning nil from @rep stops replacing in the current line
+//
+// returns the line numbers of the lines that changed
+//
+// @block: the number of lines to replace at once (default: 1)
+func (reg *RegexpRE2) RepLinesFunc(dst io.Writer, src io.Reader, rep func(data func(int) []byte) []byte, block ...int) ([]int, error) {
+	return repLines(reg, dst, src, block, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+//* shared line methods
+
+// matchLines returns the line numbers of the blocks in @src that have a match
+func matchLines(reg matcher, src io.Reader, block []int) ([]int, error) {
+	lines := []int{}
+	err := lineBlocks(src, block, func(line int, text []byte, eol []byte) error {
+		it := reg.matches(text, 0)
+		if it.Next() {
+			lines = append(lines, line)
+		}
+		return it.Err()
+	})
+	return lines, err
+}
+
+// repLines replaces every match in each block of @src, and writes the blocks to @dst with their line endings
+func repLines(reg matcher, dst io.Writer, src io.Reader, block []int, rep func(m *Match) []byte) ([]int, error) {
+	w := bufio.NewWriter(dst)
+	lines := []int{}
+
+	err := lineBlocks(src, block, func(line int, text []byte, eol []byte) error {
+		res, err := repN(reg.matches(text, 0), text, -1, rep)
+		if err != nil {
+			return err
+		}
+
+		// a replacement with the same text (ie: "$0") does not change the line
+		if !bytes.Equal(res, text) {
+			lines = append(lines, line)
+			text = res
+		}
+
+		if _, err := w.Write(text); err != nil {
+			return err
+		}
+		_, err = w.Write(eol)
+		return err
+	})
+	if err != nil {
+		return lines, err
+	}
+
+	return lines, w.Flush()
+}
+
+// lineBlocks reads @src one block of lines at a time, and calls @fn with the text and line ending of each block
+//
+// @text has the line endings of every line in the block but the last, and @eol is the line ending of the last line
+// (empty if the input does not end with a newline)
+//
+// @line is the line number of the first line in the block
+func lineBlocks(src io.Reader, block []int, fn func(line int, text []byte, eol []byte) error) error {
+	n := 1
+	if len(block) != 0 && block[0] > 1 {
+		n = block[0]
+	}
+
+	r := bufio.NewReader(src)
+	buf := []byte{}
+	count := 0
+	line := 1
+
+	for {
+		b, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if len(b) != 0 {
+			buf = append(buf, b...)
+			count++
+		}
+
+		if count != 0 && (count == n || err == io.EOF) {
+			eol := 0
+			if bytes.HasSuffix(buf, []byte("\r\n")) {
+				eol = 2
+			} else if bytes.HasSuffix(buf, []byte("\n")) {
+				eol = 1
+			}
+
+			if err := fn(line, buf[:len(buf)-eol], buf[len(buf)-eol:]); err != nil {
+				return err
+			}
+
+			line += count
+			buf = buf[:0]
+			count = 0
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package regex
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/GRbit/go-pcre"
+)
+
+// Newline sets which chars PCRE treats as a newline for ^, $ and .
+type Newline int
+
+const (
+	// NewlineDefault uses the default newline of the PCRE library (usually LF)
+	NewlineDefault Newline = iota
+	NewlineLF
+	NewlineCR
+	NewlineCRLF
+	// NewlineAnyCRLF accepts CR, LF or CRLF
+	NewlineAnyCRLF
+	// NewlineAny accepts any unicode newline
+	NewlineAny
+)
+
+// Options sets the flags used to compile a regex
+//
+// the zero value uses the same flags as Comp
+type Options struct {
+	// Caseless is the same as the (?i) flag
+	Caseless bool
+
+	// Multiline is the same as the (?m) flag
+	Multiline bool
+
+	// DotAll is the same as the (?s) flag
+	DotAll bool
+
+	// Ungreedy is the same as the (?U) flag
+	Ungreedy bool
+
+	// Extended ignores whitespace and # comments in the regex (PCRE only)
+	Extended bool
+
+	// UCP uses unicode properties for \d, \w, \s and similar (PCRE only)
+	UCP bool
+
+	// NoUTF8 compiles in binary mode, where each byte is one char (PCRE only)
+	NoUTF8 bool
+
+	// NoUTF8Check skips the utf8 validity check of the regex and input (PCRE only)
+	//
+	// note: the input must be valid utf8, or the result is undefined
+	NoUTF8Check bool
+
+	// Newline sets which chars are treated as a newline (PCRE only)
+	Newline Newline
+
+	// JIT compiles the regex with JIT, which is slower to compile but faster to match (PCRE only)
+	//
+	// RE2 ignores this option
+	JIT bool
+
+	// MatchLimit sets the max number of backtracking steps for one match attempt (PCRE only)
+	//
+	// 0 uses the value of SetMatchLimit, RE2 ignores this option since it always runs in linear time
+	MatchLimit int
+
+	// RecursionLimit sets the max recursion depth for one match attempt (PCRE only)
+	//
+	// 0 uses the value of SetRecursionLimit, RE2 ignores this option
+	RecursionLimit int
+}
+
+// ErrUnsupportedOption is returned when an engine does not support a compile option
+var ErrUnsupportedOption = errors.New("regex: unsupported compile option")
+
+// cacheKey returns the cache key of a regex compiled with these options
+//
+// the zero value uses the regex as the key, so it shares its cache with Comp
+func (opts Options) cacheKey(re string) string {
+	if opts == (Options{}) {
+		return re
+	}
+
+	// a NUL byte cannot be part of a compiled regex, so the key cannot collide
+	return fmt.Sprintf("%v\x00%s", opts, re)
+}
+
+// pcreFlags returns the PCRE compile flags for these options
+func (opts Options) pcreFlags() int {
+	flags := 0
+	if !opts.NoUTF8 {
+		flags |= pcre.UTF8
+	}
+	if opts.Caseless {
+		flags |= pcre.CASELESS
+	}
+	if opts.Multiline {
+		flags |= pcre.MULTILINE
+	}
+	if opts.DotAll {
+		flags |= pcre.DOTALL
+	}
+	if opts.Ungreedy {
+		flags |= pcre.UNGREEDY
+	}
+	if opts.Extended {
+		flags |= pcre.EXTENDED
+	}
+	if opts.UCP {
+		flags |= pcre.UCP
+	}
+	if opts.NoUTF8Check {
+		flags |= pcre.NO_UTF8_CHECK
+	}
+
+	switch opts.Newline {
+	case NewlineLF:
+		flags |= pcre.NEWLINE_LF
+	case NewlineCR:
+		flags |= pcre.NEWLINE_CR
+	case NewlineCRLF:
+		flags |= pcre.NEWLINE_CRLF
+	case NewlineAnyCRLF:
+		flags |= pcre.NEWLINE_ANYCRLF
+	case NewlineAny:
+		flags |= pcre.NEWLINE_ANY
+	}
+
+	return flags
+}
+
+// pcreExecFlags returns the PCRE match flags for these options
+func (opts Options) pcreExecFlags() int {
+	if opts.NoUTF8Check {
+		return pcre.NO_UTF8_CHECK
+	}
+	return 0
+}
+
+// re2Flags returns the inline flags for these options, or an error if an option is only supported by PCRE
+//
+// JIT and the limits are ignored, since RE2 always runs in linear time
+func (opts Options) re2Flags() (string, error) {
+	if opts.Extended || opts.UCP || opts.NoUTF8 {
+		return "", ErrUnsupportedOption
+	} else if opts.Newline != NewlineDefault && opts.Newline != NewlineLF {
+		return "", ErrUnsupportedOption
+	}
+
+	flags := ""
+	if opts.Caseless {
+		flags += "i"
+	}
+	if opts.Multiline {
+		flags += "m"
+	}
+	if opts.DotAll {
+		flags += "s"
+	}
+	if opts.Ungreedy {
+		flags += "U"
+	}
+
+	if flags == "" {
+		return "", nil
+	}
+	return "(?" + flags + ")", nil
+}
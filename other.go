@@ -2,40 +2,72 @@ package regex
 
 // Match returns true if a []byte matches a regex
 func (reg *Regexp) Match(str []byte) bool {
-	return reg.RE.MatchWFlags(str, 0)
+	return reg.re().MatchWFlags(str, reg.flags)
+}
+
+// MatchTry is the same as Match, but returns an error if the regex failed to match
+//
+// ie: ErrMatchLimit when the backtracking limit was reached
+func (reg *Regexp) MatchTry(str []byte) (bool, error) {
+	m := reg.re().NewMatcher(str, reg.flags)
+	if m.Error != nil {
+		return false, execError(m.Error)
+	}
+	return m.Matches, nil
 }
 
 // Split splits a string, and keeps capture groups
 //
 // Similar to JavaScript .split(/re/)
+//
+// use SplitWith for a limit, or to keep empty fields
 func (reg *Regexp) Split(str []byte) [][]byte {
-	ind := reg.RE.FindAllIndex(str, 0)
+	res, _ := split(reg.Matches(str), str, SplitOptions{})
+	return res
+}
 
-	res := [][]byte{}
-	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.NewMatcher(v, 0)
+// SplitTry is the same as Split, but returns an error if the regex failed to match
+func (reg *Regexp) SplitTry(str []byte) ([][]byte, error) {
+	res, err := split(reg.Matches(str), str, SplitOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
 
-		if trim == 0 {
-			res = append(res, str[:pos[0]])
-		} else {
-			res = append(res, str[trim:pos[0]])
-		}
-		trim = pos[1]
+// SubexpNames returns the names of the capture groups in the regex
+//
+// names[0] is the full match, and unnamed groups have an empty name
+func (reg *Regexp) SubexpNames() []string {
+	return reg.names
+}
 
-		for i := 1; i <= m.Groups; i++ {
-			g := m.Group(i)
-			if len(g) != 0 {
-				res = append(res, m.Group(i))
-			}
+// SubexpIndex returns the index of the first capture group with the given name, or -1 if there is none
+//
+// this can be used inside RepFunc to get a named group with data(reg.SubexpIndex("name"))
+func (reg *Regexp) SubexpIndex(name string) int {
+	if name == "" {
+		return -1
+	}
+	for i, n := range reg.names {
+		if n == name {
+			return i
 		}
 	}
+	return -1
+}
 
-	e := str[trim:]
-	if len(e) != 0 {
-		res = append(res, str[trim:])
+// NamedGroups returns every named capture group of a match as a map
+//
+// @data: the data callback from RepFunc
+func (reg *Regexp) NamedGroups(data func(int) []byte) map[string][]byte {
+	res := map[string][]byte{}
+	for i, n := range reg.names {
+		if n != "" {
+			if _, ok := res[n]; !ok {
+				res[n] = data(i)
+			}
+		}
 	}
-
 	return res
 }
@@ -0,0 +1,272 @@
+package regex
+
+/*
+#cgo pkg-config: libpcre
+#include <pcre.h>
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/GRbit/go-pcre"
+	"github.com/tkdeng/goregex/common"
+)
+
+// cacheFileVersion is the version of the file format used by SaveCache
+const cacheFileVersion = 2
+
+// ErrCacheFile is returned by LoadCache when a file was not made by SaveCache, or by a newer version of this module
+var ErrCacheFile = errors.New("regex: invalid cache file")
+
+// ErrPCREVersion is returned by LoadCache when a file was saved with a different version of the PCRE library
+var ErrPCREVersion = errors.New("regex: cache file has a different PCRE version")
+
+// cacheFile is the file written by SaveCache
+type cacheFile struct {
+	Format int `json:"format"`
+
+	// PCRE is the version of the PCRE library the regex were compiled with
+	PCRE string `json:"pcre"`
+
+	Entries []cacheFileEntry `json:"entries"`
+}
+
+// cacheFileEntry is a regex in a cache file
+//
+// only the pattern and its flags are saved, and the regex is compiled again by LoadCache
+type cacheFileEntry struct {
+	Engine string   `json:"engine"`
+	Key    string   `json:"key"`
+	Expr   string   `json:"expr"`
+	Len    int64    `json:"len"`
+	Names  []string `json:"names,omitempty"`
+	Flags  int      `json:"flags,omitempty"`
+	CFlags int      `json:"cflags,omitempty"`
+
+	// JIT is true if the regex was compiled with JIT (or tried to be)
+	JIT bool `json:"jit,omitempty"`
+}
+
+// PCREVersion returns the version of the PCRE library (ie: "8.45 2021-06-15")
+func PCREVersion() string {
+	return C.GoString(C.pcre_version())
+}
+
+// Preload compiles PCRE patterns into the cache in parallel, so the first requests do not pay the compile cost
+//
+// every pattern is compiled, and the errors of every pattern that failed are returned at once (see errors.Join)
+func Preload(patterns ...string) error {
+	return preload(patterns, func(i int) error {
+		_, err := CompTry(patterns[i])
+		return err
+	})
+}
+
+// PreloadRE2 compiles RE2 patterns into the cache in parallel, the same as Preload
+func PreloadRE2(patterns ...string) error {
+	return preload(patterns, func(i int) error {
+		_, err := CompTryRE2(patterns[i])
+		return err
+	})
+}
+
+// preload runs @comp with the index of every pattern on a pool of workers, and joins the errors in the order of the patterns
+func preload(patterns []string, comp func(i int) error) error {
+	errs := make([]error, len(patterns))
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := min(runtime.GOMAXPROCS(0), len(patterns)); w > 0; w-- {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if err := comp(i); err != nil {
+					errs[i] = fmt.Errorf("%q: %w", patterns[i], err)
+				}
+			}
+		}()
+	}
+
+	for i := range patterns {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// SaveCache writes the compiled regex in the PCRE and RE2 caches to a file, so LoadCache can warm the cache on the next start
+//
+// only the patterns and their flags are saved (not the compiled regex), and the file is replaced atomically
+//
+// @n: the max number of regex to save from each cache, with the most used regex first (0 for every regex)
+func SaveCache(path string, n int) error {
+	file := cacheFile{Format: cacheFileVersion, PCRE: PCREVersion()}
+
+	for _, e := range hotEntries(cache.Snapshot(), n) {
+		reg, err := cache.Peek(e.Key)
+		if reg == nil || err != nil {
+			continue
+		}
+		file.Entries = append(file.Entries, cacheFileEntry{
+			Engine: "pcre",
+			Key:    e.Key,
+			Expr:   reg.expr,
+			Len:    reg.len,
+			Names:  reg.names,
+			Flags:  reg.flags,
+			CFlags: reg.cflags,
+			JIT:    reg.jitDone.Load(),
+		})
+	}
+
+	for _, e := range hotEntries(cacheRE2.Snapshot(), n) {
+		reg, err := cacheRE2.Peek(e.Key)
+		if reg == nil || err != nil {
+			continue
+		}
+		file.Entries = append(file.Entries, cacheFileEntry{
+			Engine: "re2",
+			Key:    e.Key,
+			Expr:   reg.RE.String(),
+			Len:    reg.len,
+		})
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".goregex-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadCache compiles the regex saved by SaveCache into the caches in parallel, the same as Preload
+//
+// a PCRE regex saved with JIT is compiled with JIT again
+//
+// if the file was saved with a different version of the PCRE library, the PCRE regex are skipped,
+// the RE2 regex are still loaded, and the error wraps ErrPCREVersion
+//
+// the errors of every regex that failed to load are returned at once (see errors.Join)
+func LoadCache(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%w: %w", ErrCacheFile, err)
+	}
+	if file.Format != cacheFileVersion {
+		return fmt.Errorf("%w: unknown format %d", ErrCacheFile, file.Format)
+	}
+
+	var errVersion error
+	entries := file.Entries
+	if file.PCRE != PCREVersion() {
+		errVersion = fmt.Errorf("%w: %q, not %q", ErrPCREVersion, file.PCRE, PCREVersion())
+
+		entries = []cacheFileEntry{}
+		for _, e := range file.Entries {
+			if e.Engine != "pcre" {
+				entries = append(entries, e)
+			}
+		}
+	}
+
+	keys := make([]string, len(entries))
+	for i, e := range entries {
+		keys[i] = e.Key
+	}
+
+	err = preload(keys, func(i int) error {
+		e := entries[i]
+
+		switch e.Engine {
+		case "pcre":
+			start := time.Now()
+			re, err := pcre.Compile(e.Expr, e.CFlags)
+			cache.AddCompileTime(time.Since(start))
+			if err != nil {
+				return err
+			}
+
+			names := e.Names
+			if len(names) != re.Groups()+1 {
+				names = subexpNames(e.Expr, e.CFlags&pcre.EXTENDED != 0, re.Groups())
+			}
+
+			compRe := &Regexp{RE: re, len: e.Len, names: names, flags: e.Flags, expr: e.Expr, cflags: e.CFlags, key: e.Key}
+			if e.JIT || jitAll.Load() {
+				compRe.compJIT()
+			}
+			cache.Set(e.Key, compRe, nil)
+
+		case "re2":
+			start := time.Now()
+			reg, err := regexp.Compile(e.Expr)
+			cacheRE2.AddCompileTime(time.Since(start))
+			if err != nil {
+				return err
+			}
+			cacheRE2.Set(e.Key, &RegexpRE2{RE: reg, len: e.Len, size: re2Size(reg)}, nil)
+
+		default:
+			return fmt.Errorf("%w: unknown engine %q", ErrCacheFile, e.Engine)
+		}
+		return nil
+	})
+
+	return errors.Join(errVersion, err)
+}
+
+// hotEntries returns the @n most used cache entries without an error
+func hotEntries(entries []common.CacheEntry, n int) []common.CacheEntry {
+	res := []common.CacheEntry{}
+	for _, e := range entries {
+		if e.Err == "" {
+			res = append(res, e)
+		}
+	}
+
+	// the entries are sorted by last use, so regex with the same hits stay in that order
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Hits > res[j].Hits
+	})
+
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res
+}
@@ -1,37 +1,40 @@
 package regex
 
 import (
+	"context"
 	"io"
 	"os"
 	"regexp"
-	"strconv"
+	"time"
 )
 
 // CompRE2 compiles an re2 regular expression and store it in the cache
 func CompRE2(re string, params ...string) *RegexpRE2 {
-	re = compRE(re, params)
+	return CompWithRE2(Options{}, re, params...)
+}
 
-	if val, err := cacheRE2.Get(re); val != nil || err != nil {
-		if err != nil {
-			panic(err)
-		}
+// CompTryRE2 tries to compile re2 or returns an error
+func CompTryRE2(re string, params ...string) (*RegexpRE2, error) {
+	return CompTryWithRE2(Options{}, re, params...)
+}
 
-		return val
+// CompWithRE2 compiles an re2 regular expression with compile options and store it in the cache
+//
+// note: options that are only supported by PCRE will cause a panic
+func CompWithRE2(opts Options, re string, params ...string) *RegexpRE2 {
+	reg, err := CompTryWithRE2(opts, re, params...)
+	if err != nil {
+		panic(err)
 	}
-
-	reg := regexp.MustCompile(re)
-
-	compRe := RegexpRE2{RE: reg, len: int64(len(re))}
-
-	cacheRE2.Set(re, &compRe, nil)
-	return &compRe
+	return reg
 }
 
-// CompTryRE2 tries to compile re2 or returns an error
-func CompTryRE2(re string, params ...string) (*RegexpRE2, error) {
+// CompTryWithRE2 tries to compile re2 with compile options or returns an error
+func CompTryWithRE2(opts Options, re string, params ...string) (*RegexpRE2, error) {
 	re = compRE(re, params)
+	key := opts.cacheKey(re)
 
-	if val, err := cacheRE2.Get(re); val != nil || err != nil {
+	if val, err := cacheRE2.Get(key); val != nil || err != nil {
 		if err != nil {
 			return &RegexpRE2{}, err
 		}
@@ -39,15 +42,23 @@ func CompTryRE2(re string, params ...string) (*RegexpRE2, error) {
 		return val, nil
 	}
 
-	reg, err := regexp.Compile(re)
+	flags, err := opts.re2Flags()
 	if err != nil {
-		cacheRE2.Set(re, nil, err)
+		cacheRE2.Set(key, nil, err)
 		return &RegexpRE2{}, err
 	}
 
-	compRe := RegexpRE2{RE: reg, len: int64(len(re))}
+	start := time.Now()
+	reg, err := regexp.Compile(flags + re)
+	cacheRE2.AddCompileTime(time.Since(start))
+	if err != nil {
+		cacheRE2.Set(key, nil, err)
+		return &RegexpRE2{}, err
+	}
+
+	compRe := RegexpRE2{RE: reg, len: int64(len(re)), size: re2Size(reg)}
 
-	cacheRE2.Set(re, &compRe, nil)
+	cacheRE2.Set(key, &compRe, nil)
 	return &compRe, nil
 }
 
@@ -57,70 +68,17 @@ func CompTryRE2(re string, params ...string) (*RegexpRE2, error) {
 //
 // similar to JavaScript .replace(/re/, function(data){})
 func (reg *RegexpRE2) RepFunc(str []byte, rep func(data func(int) []byte) []byte, blank ...bool) []byte {
-	ind := reg.RE.FindAllIndex(str, -1)
-
-	res := []byte{}
-	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.FindAllSubmatch(v, -1)
-
-		if len(blank) != 0 {
-			gCache := map[int][]byte{}
-			r := rep(func(g int) []byte {
-				if v, ok := gCache[g]; ok {
-					return v
-				}
-				v := []byte{}
-				if len(m[0]) > g {
-					v = m[0][g]
-				}
-				gCache[g] = v
-				return v
-			})
-
-			if []byte(r) == nil {
-				return []byte{}
-			}
-		} else {
-			if trim == 0 {
-				res = append(res, str[:pos[0]]...)
-			} else {
-				res = append(res, str[trim:pos[0]]...)
-			}
-			trim = pos[1]
-
-			gCache := map[int][]byte{}
-			r := rep(func(g int) []byte {
-				if v, ok := gCache[g]; ok {
-					return v
-				}
-				v := []byte{}
-				if len(m[0]) > g {
-					v = m[0][g]
-				}
-				gCache[g] = v
-				return v
-			})
-
-			if []byte(r) == nil {
-				res = append(res, str[trim:]...)
-				return res
-			}
-
-			res = append(res, r...)
-		}
-	}
-
-	if len(blank) != 0 {
-		return []byte{}
-	}
-
-	res = append(res, str[trim:]...)
-
+	res, _ := repFunc(reg.Matches(str), str, rep, len(blank) != 0)
 	return res
 }
 
+// RepFuncTry is the same as RepFunc, but returns an error if the regex failed to match
+//
+// note: RE2 always runs in linear time, so the error is always nil
+func (reg *RegexpRE2) RepFuncTry(str []byte, rep func(data func(int) []byte) []byte, blank ...bool) ([]byte, error) {
+	return reg.RepFunc(str, rep, blank...), nil
+}
+
 // RepStrLit replaces a string with another string
 //
 // @rep uses the literal string, and does Not use args like $1
@@ -128,6 +86,13 @@ func (reg *RegexpRE2) RepStrLit(str []byte, rep []byte) []byte {
 	return reg.RE.ReplaceAllLiteral(str, rep)
 }
 
+// RepStrLitTry is the same as RepStrLit, but returns an error if the regex failed to match
+//
+// note: RE2 always runs in linear time, so the error is always nil
+func (reg *RegexpRE2) RepStrLitTry(str []byte, rep []byte) ([]byte, error) {
+	return reg.RepStrLit(str, rep), nil
+}
+
 // RepStr is a more complex version of the RepStrLit method
 //
 // this function will replace things in the result like $1 with your capture groups
@@ -135,88 +100,75 @@ func (reg *RegexpRE2) RepStrLit(str []byte, rep []byte) []byte {
 // use $0 to use the full regex capture group
 //
 // use ${123} to use numbers with more than one digit
+//
+// use ${name} to use a named capture group like (?P<name>re)
 func (reg *RegexpRE2) RepStr(str []byte, rep []byte) []byte {
-	ind := reg.RE.FindAllIndex(str, -1)
-
-	res := []byte{}
-	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.FindAllSubmatch(v, -1)
-
-		if trim == 0 {
-			res = append(res, str[:pos[0]]...)
-		} else {
-			res = append(res, str[trim:pos[0]]...)
-		}
-		trim = pos[1]
-
-		r := regComplexSel.RepFunc(rep, func(data func(int) []byte) []byte {
-			if len(data(1)) != 0 {
-				return data(0)
-			}
-			n := data(2)
-			if len(n) > 1 {
-				n = n[1 : len(n)-1]
-			}
-			if i, err := strconv.Atoi(string(n)); err == nil {
-				if len(m[0]) > i {
-					return m[0][i]
-				}
-			}
-			return []byte{}
-		})
-
-		if r == nil {
-			res = append(res, str[trim:]...)
-			return res
-		}
-
-		res = append(res, r...)
-	}
-
-	res = append(res, str[trim:]...)
-
+	res, _ := repStr(reg.Matches(str), str, rep)
 	return res
 }
 
+// RepStrTry is the same as RepStr, but returns an error if the regex failed to match
+//
+// note: RE2 always runs in linear time, so the error is always nil
+func (reg *RegexpRE2) RepStrTry(str []byte, rep []byte) ([]byte, error) {
+	return reg.RepStr(str, rep), nil
+}
+
 // Match returns true if a []byte matches a regex
 func (reg *RegexpRE2) Match(str []byte) bool {
 	return reg.RE.Match(str)
 }
 
+// MatchTry is the same as Match, but returns an error if the regex failed to match
+//
+// note: RE2 always runs in linear time, so the error is always nil
+func (reg *RegexpRE2) MatchTry(str []byte) (bool, error) {
+	return reg.RE.Match(str), nil
+}
+
 // Split splits a string, and keeps capture groups
 //
 // Similar to JavaScript .split(/re/)
+//
+// use SplitWith for a limit, or to keep empty fields
 func (reg *RegexpRE2) Split(str []byte) [][]byte {
-	ind := reg.RE.FindAllIndex(str, -1)
-
-	res := [][]byte{}
-	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.FindAllSubmatch(v, -1)
-
-		if trim == 0 {
-			res = append(res, str[:pos[0]])
-		} else {
-			res = append(res, str[trim:pos[0]])
-		}
-		trim = pos[1]
+	res, _ := split(reg.Matches(str), str, SplitOptions{})
+	return res
+}
+
+// SplitTry is the same as Split, but returns an error if the regex failed to match
+//
+// note: RE2 always runs in linear time, so the error is always nil
+func (reg *RegexpRE2) SplitTry(str []byte) ([][]byte, error) {
+	return reg.Split(str), nil
+}
+
+// SubexpNames returns the names of the capture groups in the regex
+//
+// names[0] is the full match, and unnamed groups have an empty name
+func (reg *RegexpRE2) SubexpNames() []string {
+	return reg.RE.SubexpNames()
+}
 
-		for i := 1; i < len(m[0]); i++ {
-			g := m[0][i]
-			if len(g) != 0 {
-				res = append(res, m[0][i])
+// SubexpIndex returns the index of the first capture group with the given name, or -1 if there is none
+//
+// this can be used inside RepFunc to get a named group with data(reg.SubexpIndex("name"))
+func (reg *RegexpRE2) SubexpIndex(name string) int {
+	return reg.RE.SubexpIndex(name)
+}
+
+// NamedGroups returns every named capture group of a match as a map
+//
+// @data: the data callback from RepFunc
+func (reg *RegexpRE2) NamedGroups(data func(int) []byte) map[string][]byte {
+	res := map[string][]byte{}
+	for i, n := range reg.RE.SubexpNames() {
+		if n != "" {
+			if _, ok := res[n]; !ok {
+				res[n] = data(i)
 			}
 		}
 	}
-
-	e := str[trim:]
-	if len(e) != 0 {
-		res = append(res, str[trim:])
-	}
-
 	return res
 }
 
@@ -246,6 +198,11 @@ func (reg *RegexpRE2) RepFileStr(file *os.File, rep []byte, all bool, maxReSize
 	buf = buf[:size]
 	for err == nil {
 		if reg.Match(buf) {
+			if !found {
+				if err := backupFile(file); err != nil {
+					return err
+				}
+			}
 			found = true
 
 			repRes := reg.RepStr(buf, rep)
@@ -325,6 +282,11 @@ func (reg *RegexpRE2) RepFileStr(file *os.File, rep []byte, all bool, maxReSize
 	}
 
 	if reg.Match(buf) {
+		if !found {
+			if err := backupFile(file); err != nil {
+				return err
+			}
+		}
 		found = true
 
 		repRes := reg.RepStr(buf, rep)
@@ -422,6 +384,11 @@ func (reg *RegexpRE2) RepFileFunc(file *os.File, rep func(data func(int) []byte)
 	buf = buf[:size]
 	for err == nil {
 		if reg.Match(buf) {
+			if !found {
+				if err := backupFile(file); err != nil {
+					return err
+				}
+			}
 			found = true
 
 			repRes := reg.RepFunc(buf, rep)
@@ -501,6 +468,11 @@ func (reg *RegexpRE2) RepFileFunc(file *os.File, rep func(data func(int) []byte)
 	}
 
 	if reg.Match(buf) {
+		if !found {
+			if err := backupFile(file); err != nil {
+				return err
+			}
+		}
 		found = true
 
 		repRes := reg.RepFunc(buf, rep)
@@ -575,32 +547,9 @@ func (reg *RegexpRE2) RepFileFunc(file *os.File, rep func(data func(int) []byte)
 }
 
 // MatchFile returns true if a file contains a regex match
+//
+// the file is read once through a sliding window (see MatchReader)
 func (reg *RegexpRE2) MatchFile(file *os.File, maxReSize ...int64) bool {
-	l := int64(reg.len * 10)
-	if l < 1024 {
-		l = 1024
-	}
-	for _, maxRe := range maxReSize {
-		if l < maxRe {
-			l = maxRe
-		}
-	}
-
-	i := int64(0)
-
-	buf := make([]byte, l)
-	size, err := file.ReadAt(buf, i)
-	buf = buf[:size]
-	for err == nil {
-		if reg.Match(buf) {
-			return true
-		}
-
-		i++
-		buf = make([]byte, l)
-		size, err = file.ReadAt(buf, i)
-		buf = buf[:size]
-	}
-
-	return reg.Match(buf)
+	ok, _ := matchFileCtx(context.Background(), reg, file, fileWindow(reg.len, maxReSize))
+	return ok
 }
@@ -5,6 +5,8 @@ import (
 	"regexp"
 	"sort"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/GRbit/go-pcre"
@@ -15,13 +17,30 @@ type PCRE pcre.Regexp
 type RE2 *regexp.Regexp
 
 type Regexp struct {
-	RE  pcre.Regexp
-	len int64
+	RE     pcre.Regexp
+	len    int64
+	names  []string
+	flags  int
+	expr   string
+	cflags int
+
+	// key is the cache key of the regex, so its size in the cache can be updated when JIT is added
+	key string
+
+	uses    atomic.Int64
+	jit     atomic.Pointer[pcre.Regexp]
+	jitDone atomic.Bool
 }
 
 type RegexpRE2 struct {
 	RE  *regexp.Regexp
 	len int64
+
+	// size is the estimated memory used by the regex, for the cache limits (see re2Size)
+	size int64
+
+	// after is the regex used to search after an offset (see matchesFrom)
+	after atomic.Pointer[regexp.Regexp]
 }
 
 type bgPart struct {
@@ -42,52 +61,8 @@ var cacheRE2 common.CacheMap[*RegexpRE2] = common.NewCache[*RegexpRE2]()
 var compCache common.CacheMap[[]byte] = common.NewCache[[]byte]()
 
 func init() {
-	regComplexSel = Comp(`(\\|)\$([0-9]|\{[0-9]+\})`)
+	regComplexSel = Comp(`(\\|)\$([0-9]|\{[0-9]+\}|\{[A-Za-z_][A-Za-z0-9_]*\})`)
 	regEscape = Comp(`[\\\^\$\.\|\?\*\+\(\)\[\]\{\}\%]`)
-
-	go func() {
-		for {
-			time.Sleep(10 * time.Minute)
-
-			// default: remove cache items have not been accessed in over 2 hours
-			cacheTime := 2 * time.Hour
-
-			// SysFreeMemory returns the total free system memory in megabytes
-			mb := common.SysFreeMemory()
-			if mb < 200 && mb != 0 {
-				// low memory: remove cache items have not been accessed in over 10 minutes
-				cacheTime = 10 * time.Minute
-			} else if mb < 500 && mb != 0 {
-				// low memory: remove cache items have not been accessed in over 30 minutes
-				cacheTime = 30 * time.Minute
-			} else if mb < 2000 && mb != 0 {
-				// low memory: remove cache items have not been accessed in over 1 hour
-				cacheTime = 1 * time.Hour
-			} else if mb > 64000 {
-				// high memory: remove cache items have not been accessed in over 12 hour
-				cacheTime = 12 * time.Hour
-			} else if mb > 32000 {
-				// high memory: remove cache items have not been accessed in over 6 hour
-				cacheTime = 6 * time.Hour
-			} else if mb > 16000 {
-				// high memory: remove cache items have not been accessed in over 3 hour
-				cacheTime = 3 * time.Hour
-			}
-
-			cache.DelOld(cacheTime)
-			cacheRE2.DelOld(cacheTime)
-			compCache.DelOld(cacheTime)
-
-			time.Sleep(10 * time.Second)
-
-			// clear cache if were still critically low on available memory
-			if mb := common.SysFreeMemory(); mb < 10 && mb != 0 {
-				cache.DelOld(0)
-				cacheRE2.DelOld(0)
-				compCache.DelOld(0)
-			}
-		}
-	}()
 }
 
 // this method compiles the RE string to add more functionality to it
@@ -111,6 +86,7 @@ func compRE(re string, params []string) string {
 		}))
 	}
 
+	start := time.Now()
 	reB := []byte(re)
 
 	reB = regCompCommentAndChars.ReplaceAllFunc(reB, func(b []byte) []byte {
@@ -200,6 +176,7 @@ func compRE(re string, params []string) string {
 		return []byte{}
 	})
 
+	compCache.AddCompileTime(time.Since(start))
 	compCache.Set(re, reB, nil)
 
 	return string(regCompParam.ReplaceAllFunc(reB, func(b []byte) []byte {
@@ -216,50 +193,259 @@ func compRE(re string, params []string) string {
 	}))
 }
 
-//* regex compile methods
+// subexpNames returns the names of the capture groups in a compiled PCRE string
+//
+// names[0] is always empty, and unnamed groups also have an empty name
+//
+// note: go-pcre does not expose the name table, so the pattern is scanned for (?<name>), (?'name') and (?P<name>)
+//
+// the scan follows the PCRE numbering rules, so groups in each branch of a (?|...) branch reset share their numbers,
+// and (?#...) comments, conditions and (with (?x) or the EXTENDED flag) # comments are not counted as groups
+//
+// @extended: true if the regex was compiled with the EXTENDED flag
+func subexpNames(re string, extended bool, groups int) []string {
+	names := []string{""}
+
+	// group is a parenthesis that has not been closed yet
+	type group struct {
+		extended bool
+
+		// reset is true for a (?| branch reset, where start is the group number at the start of each branch,
+		// and max is the highest group number of the branches so far
+		reset bool
+		start int
+		max   int
+	}
+	stack := []group{}
+	n := 0
+
+	for i := 0; i < len(re); i++ {
+		switch re[i] {
+		case '\\':
+			if i+1 < len(re) && re[i+1] == 'Q' {
+				if e := strings.Index(re[i+2:], `\E`); e != -1 {
+					i += e + 3
+				} else {
+					i = len(re)
+				}
+				continue
+			}
+			i++
+		case '#':
+			if extended {
+				if e := strings.IndexByte(re[i:], '\n'); e != -1 {
+					i += e
+				} else {
+					i = len(re)
+				}
+			}
+		case '[':
+			i++
+			if i < len(re) && re[i] == '^' {
+				i++
+			}
+			if i < len(re) && re[i] == ']' {
+				i++
+			}
+			for ; i < len(re) && re[i] != ']'; i++ {
+				if re[i] == '\\' {
+					i++
+				} else if strings.HasPrefix(re[i:], "[:") {
+					if e := strings.Index(re[i+2:], ":]"); e != -1 {
+						i += e + 3
+					}
+				}
+			}
+		case '|':
+			if len(stack) != 0 && stack[len(stack)-1].reset {
+				g := &stack[len(stack)-1]
+				g.max = max(g.max, n)
+				n = g.start
+			}
+		case ')':
+			if len(stack) != 0 {
+				g := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				extended = g.extended
+				if g.reset {
+					n = max(g.max, n)
+				}
+			}
+		case '(':
+			if i+1 < len(re) && re[i+1] == '*' {
+				// a verb, ie: (*UTF8)
+				if e := strings.IndexByte(re[i:], ')'); e != -1 {
+					i += e
+				} else {
+					i = len(re)
+				}
+				continue
+			}
 
-// Comp compiles a regular expression and store it in the cache
-func Comp(re string, params ...string) *Regexp {
-	re = compRE(re, params)
+			stack = append(stack, group{extended: extended})
 
-	if val, err := cache.Get(re); val != nil || err != nil {
-		if err != nil {
-			panic(err)
+			if i+1 >= len(re) || re[i+1] != '?' {
+				n++
+				for len(names) <= n {
+					names = append(names, "")
+				}
+				continue
+			}
+
+			var name string
+			if strings.HasPrefix(re[i+2:], "#") {
+				// comment
+				stack = stack[:len(stack)-1]
+				if e := strings.IndexByte(re[i:], ')'); e != -1 {
+					i += e
+				} else {
+					i = len(re)
+				}
+				continue
+			} else if strings.HasPrefix(re[i+2:], "|") {
+				stack[len(stack)-1].reset = true
+				stack[len(stack)-1].start = n
+				stack[len(stack)-1].max = n
+				i += 2
+				continue
+			} else if strings.HasPrefix(re[i+2:], "(") && !strings.HasPrefix(re[i+3:], "?") {
+				// the condition of a conditional group, ie: (?(1)...) or (?(<name>)...)
+				if e := strings.IndexByte(re[i+2:], ')'); e != -1 {
+					i += e + 2
+				} else {
+					i = len(re)
+				}
+				continue
+			} else if on, ok := inlineFlags(re[i+2:]); ok {
+				// (?x) sets the flag until the end of the group it is in, and (?x:...) only inside the new group
+				e := strings.IndexAny(re[i+2:], ":)")
+				if re[i+2+e] == ')' {
+					stack = stack[:len(stack)-1]
+				}
+				extended = on(extended)
+				i += e + 2
+				continue
+			} else if strings.HasPrefix(re[i+2:], "P<") {
+				name = re[i+4:]
+			} else if strings.HasPrefix(re[i+2:], "<") && !strings.HasPrefix(re[i+2:], "<=") && !strings.HasPrefix(re[i+2:], "<!") {
+				name = re[i+3:]
+			} else if strings.HasPrefix(re[i+2:], "'") {
+				name = re[i+3:]
+			} else {
+				continue
+			}
+
+			if e := strings.IndexAny(name, ">'"); e != -1 {
+				name = name[:e]
+			}
+			n++
+			for len(names) <= n {
+				names = append(names, "")
+			}
+			if names[n] == "" {
+				names[n] = name
+			}
 		}
+	}
 
-		return val
+	for len(names) < groups+1 {
+		names = append(names, "")
 	}
+	return names[:groups+1]
+}
 
-	reg := pcre.MustCompile(re, pcre.UTF8)
+// inlineFlags reads the option letters of a (?imsx-imsx) or (?imsx-imsx: group, after the "(?"
+//
+// returns a func that applies the x option to the current extended mode,
+// and false if the group does not set options
+func inlineFlags(re string) (func(extended bool) bool, bool) {
+	e := strings.IndexAny(re, ":)")
+	if e == -1 {
+		return nil, false
+	}
 
-	// commented below methods compiled 10000 times in 0.1s (above method being used finished in half of that time)
-	// reg := pcre.MustCompileParse(re)
-	// reg := pcre.MustCompileJIT(re, pcre.UTF8, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileJIT(re, pcre.EXTRA, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileJIT(re, pcre.JAVASCRIPT_COMPAT, pcre.STUDY_JIT_COMPILE)
-	// reg := pcre.MustCompileParseJIT(re, pcre.STUDY_JIT_COMPILE)
+	set, unset, off := false, false, false
+	for _, c := range re[:e] {
+		switch c {
+		case '-':
+			off = true
+		case 'x':
+			if off {
+				set, unset = false, true
+			} else {
+				set, unset = true, false
+			}
+		case 'i', 'm', 's', 'J', 'U', 'X':
+		default:
+			return nil, false
+		}
+	}
+
+	return func(extended bool) bool {
+		if set {
+			return true
+		} else if unset {
+			return false
+		}
+		return extended
+	}, true
+}
 
-	compRe := Regexp{RE: reg, len: int64(len(re))}
+//* regex compile methods
 
-	cache.Set(re, &compRe, nil)
-	return &compRe
+// Comp compiles a regular expression and store it in the cache
+func Comp(re string, params ...string) *Regexp {
+	return CompWith(Options{}, re, params...)
 }
 
 // CompTry tries to compile or returns an error
 func CompTry(re string, params ...string) (*Regexp, error) {
+	return CompTryWith(Options{}, re, params...)
+}
+
+// CompWith compiles a regular expression with compile options and store it in the cache
+//
+// regex compiled with different options are cached separately
+func CompWith(opts Options, re string, params ...string) *Regexp {
+	reg, err := CompTryWith(opts, re, params...)
+	if err != nil {
+		panic(err)
+	}
+	return reg
+}
+
+// CompTryWith tries to compile with compile options or returns an error
+func CompTryWith(opts Options, re string, params ...string) (*Regexp, error) {
 	re = compRE(re, params)
 
-	if val, err := cache.Get(re); val != nil || err != nil {
+	if opts.MatchLimit == 0 {
+		opts.MatchLimit = int(matchLimit.Load())
+	}
+	if opts.RecursionLimit == 0 {
+		opts.RecursionLimit = int(recursionLimit.Load())
+	}
+
+	key := opts.cacheKey(re)
+
+	if val, err := cache.Get(key); val != nil || err != nil {
 		if err != nil {
 			return &Regexp{}, err
 		}
 
+		if jitAll.Load() {
+			val.compJIT()
+		}
+
 		return val, nil
 	}
 
-	reg, err := pcre.Compile(re, pcre.UTF8)
+	expr := opts.limitPrefix() + re
+
+	start := time.Now()
+	reg, err := pcre.Compile(expr, opts.pcreFlags())
+	cache.AddCompileTime(time.Since(start))
 	if err != nil {
-		cache.Set(re, nil, err)
+		cache.Set(key, nil, err)
 		return &Regexp{}, err
 	}
 
@@ -270,10 +456,14 @@ func CompTry(re string, params ...string) (*Regexp, error) {
 	// reg := pcre.MustCompileJIT(re, pcre.JAVASCRIPT_COMPAT, pcre.STUDY_JIT_COMPILE)
 	// reg := pcre.MustCompileParseJIT(re, pcre.STUDY_JIT_COMPILE)
 
-	compRe := Regexp{RE: reg, len: int64(len(re))}
+	compRe := &Regexp{RE: reg, len: int64(len(re)), names: subexpNames(re, opts.Extended, reg.Groups()), flags: opts.pcreExecFlags(), expr: expr, cflags: opts.pcreFlags(), key: key}
+
+	if opts.JIT || jitAll.Load() {
+		compRe.compJIT()
+	}
 
-	cache.Set(re, &compRe, nil)
-	return &compRe, nil
+	cache.Set(key, compRe, nil)
+	return compRe, nil
 }
 
 //* other regex methods
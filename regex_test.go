@@ -2,11 +2,24 @@ package regex
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"expvar"
+	"fmt"
+	"io"
 	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/GRbit/go-pcre"
+	"github.com/tkdeng/goregex/common"
 )
 
 func TestCompile(t *testing.T) {
@@ -129,3 +142,1371 @@ func TestValid(t *testing.T) {
 	check(`(?<test>)`, true)
 	check(`(?i)test`, true)
 }
+
+func TestNamedGroups(t *testing.T) {
+	var check = func(s string, re, r string, e string) {
+		res := Comp(re).RepStr([]byte(s), []byte(r))
+		if !bytes.Equal(res, []byte(e)) {
+			t.Error("[", string(res), "]\n", errors.New("result does not match expected result"))
+		}
+
+		res = CompRE2(re).RepStr([]byte(s), []byte(r))
+		if !bytes.Equal(res, []byte(e)) {
+			t.Error("[", string(res), "] (RE2)\n", errors.New("result does not match expected result"))
+		}
+	}
+
+	check("date: 2024-08-15", `(?<year>[0-9]+)-(?<month>[0-9]+)-(?<day>[0-9]+)`, "${day}/${month}/${year}", "date: 15/08/2024")
+	check("name = value", `(?P<key>\w+) = (?P<val>\w+)`, "${val}=${key}${missing}", "value=name")
+
+	reg := Comp(`(\w+)@(?<host>\w+)`)
+	res := reg.RepFunc([]byte("user@example"), func(data func(int) []byte) []byte {
+		g := reg.NamedGroups(data)
+		return JoinBytes(data(reg.SubexpIndex("host")), '/', g["host"], data(reg.SubexpIndex("missing")))
+	})
+	if !bytes.Equal(res, []byte("example/example")) {
+		t.Error("[", string(res), "]\n", errors.New("result does not match expected result"))
+	}
+
+	var checkNames = func(re string, extended bool, groups int, e []string) {
+		if names := subexpNames(re, extended, groups); fmt.Sprint(names) != fmt.Sprint(e) || len(names) != len(e) {
+			t.Error("[", re, names, "]\n", errors.New("group names do not match expected result"))
+		}
+	}
+
+	checkNames(`(?|(?<a>x)|(y)(?<b>z))(?<c>w)`, false, 3, []string{"", "a", "b", "c"})
+	checkNames(`(?|(a)|(b))(?#(c))(?<d>d)`, false, 2, []string{"", "", "d"})
+	checkNames("(?x) a # (b)\n (?<c>c)", false, 1, []string{"", "c"})
+	checkNames("a # (b)\n (?<c>c)", true, 1, []string{"", "c"})
+	checkNames("(?x: # (b)\n) # (?<c>c)", false, 1, []string{"", "c"})
+	checkNames(`(?(1)a|b)[(](?<x>x)[[:alpha:](]`, false, 1, []string{"", "x"})
+	checkNames(`(*UTF8)(?i)(?<a>a)`, false, 1, []string{"", "a"})
+}
+
+func TestFind(t *testing.T) {
+	var check = func(s string, re string, n int, e []string) {
+		for _, res := range [][]*Match{Comp(re).FindAll([]byte(s), n), CompRE2(re).FindAll([]byte(s), n)} {
+			if len(res) != len(e) {
+				t.Error("[", len(res), "]\n", errors.New("number of matches does not match expected result"))
+				continue
+			}
+			for i, m := range res {
+				if string(m.Bytes()) != e[i] || !bytes.Equal(m.Input[m.Start():m.End()], m.Group(0)) {
+					t.Error("[", string(m.Bytes()), "]\n", errors.New("result does not match expected result"))
+				}
+			}
+		}
+	}
+
+	check("a1 b22 c333", `[0-9]+`, -1, []string{"1", "22", "333"})
+	check("a1 b22 c333", `[0-9]+`, 2, []string{"1", "22"})
+	check("baaac", `a*`, -1, []string{"", "aaa", ""})
+	check("no digits", `[0-9]+`, -1, []string{})
+
+	re := `(?<key>\w+)=(\w+)?`
+	for _, m := range []*Match{Comp(re).Find([]byte("x a=1")), CompRE2(re).Find([]byte("x a=1"))} {
+		if m == nil || m.Start() != 2 || m.End() != 5 || string(m.Named("key")) != "a" || string(m.Group(2)) != "1" || m.Groups() != 2 {
+			t.Error("[", m, "]\n", errors.New("result does not match expected result"))
+		}
+	}
+
+	if ind := Comp(`b+`).FindIndex([]byte("abbc")); len(ind) != 2 || ind[0] != 1 || ind[1] != 3 {
+		t.Error("[", ind, "]\n", errors.New("result does not match expected result"))
+	}
+	if sub := CompRE2(`(a)(x)?`).FindSubmatch([]byte("ba")); len(sub) != 3 || string(sub[1]) != "a" || sub[2] != nil {
+		t.Error("[", sub, "]\n", errors.New("result does not match expected result"))
+	}
+	if Comp(`z`).Find([]byte("abc")) != nil || Comp(`z`).FindSubmatch([]byte("abc")) != nil {
+		t.Error(errors.New("expected no match"))
+	}
+
+	// each next match is searched with the text before it, so both engines find the same matches
+	for _, c := range []struct {
+		str string
+		re  string
+	}{{"xx", `^x`}, {"x y\nx", `(?m)^x`}, {"ab ab", `\bab`}, {"xx", `\bx`}, {"xx", `\Bx`}, {"aaa", `\ba*`}, {"a.b.c", `\b`}} {
+		var res, res2 []string
+		for _, m := range Comp(c.re).FindAll([]byte(c.str), -1) {
+			res = append(res, strconv.Itoa(m.Start())+":"+string(m.Bytes()))
+		}
+		for _, m := range CompRE2(c.re).FindAll([]byte(c.str), -1) {
+			res2 = append(res2, strconv.Itoa(m.Start())+":"+string(m.Bytes()))
+		}
+		if strings.Join(res, ",") != strings.Join(res2, ",") {
+			t.Error("[", c.re, res, res2, "]\n", errors.New("pcre matches do not match re2 matches"))
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	s := []byte("a1 b2 c3 d4 e5 f6 g7 h8 i9 j10 k11 l12")
+
+	for _, it := range []*MatchIter{Comp(`[a-z]([0-9]+)`).Matches(s), CompRE2(`[a-z]([0-9]+)`).Matches(s)} {
+		n := 0
+		for it.Next() {
+			n++
+			if string(it.Match().Group(1)) != strconv.Itoa(n) {
+				t.Error("[", string(it.Match().Bytes()), "]\n", errors.New("result does not match expected result"))
+			}
+		}
+		if n != 12 || it.Next() {
+			t.Error("[", n, "]\n", errors.New("number of matches does not match expected result"))
+		}
+	}
+
+	it := Comp(`[a-z]`).Matches(s)
+	for it.Next() {
+		if it.Match().Bytes()[0] == 'c' {
+			break
+		}
+	}
+	if it.Match().Start() != 6 {
+		t.Error("[", it.Match().Start(), "]\n", errors.New("failed to stop early"))
+	}
+}
+
+func TestEngine(t *testing.T) {
+	for _, name := range []string{"pcre", "re2"} {
+		reg := CompEngine(name, `(t)est`)
+		if res := reg.RepStr([]byte("a test"), []byte("$1ry")); !bytes.Equal(res, []byte("a try")) {
+			t.Error("[", name, string(res), "]\n", errors.New("result does not match expected result"))
+		}
+	}
+
+	if _, err := CompTryEngine("missing", `test`); !errors.Is(err, ErrUnknownEngine) {
+		t.Error("[", err, "]\n", errors.New("expected unknown engine error"))
+	}
+
+	RegisterEngine("custom", func(re string, params ...string) (Engine, error) {
+		return CompTryRE2(`(?i)`+re, params...)
+	})
+	defer RegisterEngine("custom", nil)
+
+	if !CompEngine("custom", `test`).Match([]byte("TEST")) {
+		t.Error("[custom]\n", errors.New("registered engine was not used"))
+	}
+}
+
+func TestOptions(t *testing.T) {
+	if !CompWith(Options{Caseless: true}, `options test`).Match([]byte("OPTIONS TEST")) {
+		t.Error("[Caseless]\n", errors.New("compile option was not used"))
+	}
+	if Comp(`options test`).Match([]byte("OPTIONS TEST")) {
+		t.Error("[Caseless]\n", errors.New("compile options share a cache key"))
+	}
+
+	if !CompWithRE2(Options{Caseless: true, DotAll: true}, `options.test`).Match([]byte("OPTIONS\nTEST")) {
+		t.Error("[Caseless, DotAll] (RE2)\n", errors.New("compile option was not used"))
+	}
+	if CompRE2(`options.test`).Match([]byte("OPTIONS\nTEST")) {
+		t.Error("[Caseless, DotAll] (RE2)\n", errors.New("compile options share a cache key"))
+	}
+
+	if _, err := CompTryWithRE2(Options{Newline: NewlineCRLF}, `test`); !errors.Is(err, ErrUnsupportedOption) {
+		t.Error("[", err, "]\n", errors.New("expected unsupported option error"))
+	}
+}
+
+func TestJIT(t *testing.T) {
+	hasJIT := pcre.Config(pcre.CONFIG_JIT) == "1"
+
+	if reg := CompWith(Options{JIT: true}, `jit (test)`); reg.JIT() != hasJIT || !reg.Match([]byte("a jit test")) {
+		t.Error("[JIT]\n", errors.New("failed to compile with JIT"))
+	}
+
+	SetJITThreshold(2)
+	defer SetJITThreshold(0)
+
+	reg := Comp(`jit threshold (test)`)
+	for i := 0; i < 3; i++ {
+		if reg.JIT() {
+			t.Error("[", i, "]\n", errors.New("regex was compiled with JIT before reaching the threshold"))
+		}
+		if !reg.Match([]byte("a jit threshold test")) {
+			t.Error("[", i, "]\n", errors.New("result does not match expected result"))
+		}
+	}
+	if reg.JIT() != hasJIT {
+		t.Error("[JIT threshold]\n", errors.New("regex was not compiled with JIT after reaching the threshold"))
+	}
+}
+
+func TestLimits(t *testing.T) {
+	s := []byte(strings.Repeat("a", 30) + "!")
+
+	reg := CompWith(Options{MatchLimit: 10}, `^(a+)+$`)
+	if ok, err := reg.MatchTry(s); ok || !errors.Is(err, ErrMatchLimit) {
+		t.Error("[", ok, err, "]\n", errors.New("expected match limit error"))
+	}
+	if _, err := reg.RepStrTry(s, []byte("$1")); !errors.Is(err, ErrMatchLimit) {
+		t.Error("[", err, "]\n", errors.New("expected match limit error"))
+	}
+	if it := reg.Matches(s); it.Next() || !errors.Is(it.Err(), ErrMatchLimit) {
+		t.Error("[", it.Err(), "]\n", errors.New("expected match limit error"))
+	}
+	if reg.Match(s) {
+		t.Error("[Match]\n", errors.New("result does not match expected result"))
+	}
+
+	SetMatchLimit(10)
+	reg = Comp(`^(a+)+$`)
+	SetMatchLimit(0)
+	if _, err := reg.SplitTry(s); !errors.Is(err, ErrMatchLimit) {
+		t.Error("[", err, "]\n", errors.New("expected match limit error from global limit"))
+	}
+	if ok, err := Comp(`^(a+)+$`).MatchTry([]byte("aaa")); !ok || err != nil {
+		t.Error("[", ok, err, "]\n", errors.New("global limit was used after being reset"))
+	}
+
+	// the error code is read from the go-pcre error text
+	var checkErr = func(rc int, e error) {
+		err := fmt.Errorf("%d, pcre_exec: limit", rc)
+		if res := execError(err); res != e && (e != nil || res != err) {
+			t.Error("[", rc, res, "]\n", errors.New("result does not match expected result"))
+		}
+	}
+
+	checkErr(pcre.ERROR_MATCHLIMIT, ErrMatchLimit)
+	checkErr(pcre.ERROR_RECURSIONLIMIT, ErrRecursionLimit)
+	checkErr(pcre.ERROR_JIT_STACKLIMIT, ErrJITStackLimit)
+	checkErr(pcre.ERROR_BADOPTION, nil)
+}
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Comp(`(a)`).RepFuncCtx(ctx, []byte("aaa"), func(data func(int) []byte) []byte {
+		return data(1)
+	}); !errors.Is(err, context.Canceled) {
+		t.Error("[", err, "]\n", errors.New("expected context canceled error"))
+	}
+
+	s := []byte(strings.Repeat("some text with a key=value pair\n", 10000))
+
+	for _, reg := range []Engine{Comp(`key=(\w+)`), CompRE2(`key=(\w+)`)} {
+		file, err := os.CreateTemp(t.TempDir(), "ctx")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		file.Write(s)
+
+		var repFile func(ctx context.Context, file *os.File, rep []byte, all bool, maxReSize ...int64) error
+		switch reg := reg.(type) {
+		case *Regexp:
+			repFile = reg.RepFileStrCtx
+		case *RegexpRE2:
+			repFile = reg.RepFileStrCtx
+		}
+
+		if err := repFile(ctx, file, []byte("val=$1!"), true); !errors.Is(err, context.Canceled) {
+			t.Error("[", err, "]\n", errors.New("expected context canceled error"))
+		}
+		if b, _ := os.ReadFile(file.Name()); !bytes.Equal(b, s) {
+			t.Error(errors.New("canceled file replace modified the file"))
+		}
+
+		if err := repFile(context.Background(), file, []byte("val=$1!"), true); err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to replace file"))
+		}
+		if b, _ := os.ReadFile(file.Name()); !bytes.Equal(b, reg.RepStr(s, []byte("val=$1!"))) {
+			t.Error(errors.New("file result does not match expected result"))
+		}
+
+		// the result is renamed over the file, so the open file is never written to
+		if b, _ := io.ReadAll(io.NewSectionReader(file, 0, int64(len(s)))); !bytes.Equal(b, s) {
+			t.Error(errors.New("expected the file to be replaced instead of written in place"))
+		}
+	}
+}
+
+func TestGeneric(t *testing.T) {
+	for _, reg := range []Finder{Comp(`a(b+)`), CompRE2(`a(b+)`)} {
+		if res := RepStr(reg, "xabbyab", "[$1]"); res != "x[bb]y[b]" {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+		if res := RepStr(reg, []byte("xabbyab"), []byte("[$1]")); string(res) != "x[bb]y[b]" {
+			t.Error("[", string(res), "]\n", errors.New("result does not match expected result"))
+		}
+		if res := RepStrLit(reg, "xaby", "$1"); res != "x$1y" {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+		if res := RepFunc(reg, "xabbyab", func(data func(int) string) string {
+			return strings.ToUpper(data(1))
+		}); res != "xBByB" {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+		if res := RepFunc(reg, "xabyab", func(data func(int) string) string {
+			return ""
+		}); res != "xy" {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+
+		if !IsMatch(reg, "xab") || IsMatch(reg, "xyz") {
+			t.Error("[IsMatch]\n", errors.New("result does not match expected result"))
+		}
+		if res := Split(reg, "xabyabz"); strings.Join(res, ",") != "x,b,y,b,z" {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+
+		if res, ok := Find(reg, "xabby"); !ok || res != "abb" {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+		if _, ok := Find(reg, "xyz"); ok {
+			t.Error("[Find]\n", errors.New("expected no match"))
+		}
+		if res := FindAll(reg, "ab abb abbb", 2); strings.Join(res, ",") != "ab,abb" {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+		if res := FindIndex(reg, "xxab"); len(res) != 2 || res[0] != 2 || res[1] != 4 {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+		if res := FindSubmatch(reg, "xabb"); len(res) != 2 || res[0] != "abb" || res[1] != "bb" {
+			t.Error("[", res, "]\n", errors.New("result does not match expected result"))
+		}
+		if res := FindSubmatch(reg, "xyz"); res != nil {
+			t.Error("[", res, "]\n", errors.New("expected no match"))
+		}
+	}
+}
+
+func TestRepN(t *testing.T) {
+	type repN interface {
+		RepStrN(str []byte, rep []byte, n int) []byte
+		RepStrLitN(str []byte, rep []byte, n int) []byte
+		RepFuncN(str []byte, rep func(data func(int) []byte) []byte, n int) []byte
+		RepStrNth(str []byte, rep []byte, nth int) []byte
+		RepStrLitNth(str []byte, rep []byte, nth int) []byte
+		RepFuncNth(str []byte, rep func(data func(int) []byte) []byte, nth int) []byte
+	}
+
+	s := []byte("k=1 k=2 k=3 k=4")
+
+	for _, reg := range []repN{Comp(`k=(\d)`), CompRE2(`k=(\d)`)} {
+		var check = func(res []byte, e string) {
+			if string(res) != e {
+				t.Error("[", string(res), "]\n", errors.New("result does not match expected result: "+e))
+			}
+		}
+
+		check(reg.RepStrN(s, []byte("v$1"), 2), "v1 v2 k=3 k=4")
+		check(reg.RepStrN(s, []byte("v$1"), -1), "v1 v2 v3 v4")
+		check(reg.RepStrN(s, []byte("v$1"), 0), "k=1 k=2 k=3 k=4")
+		check(reg.RepStrLitN(s, []byte("$1"), 1), "$1 k=2 k=3 k=4")
+		check(reg.RepFuncN(s, func(data func(int) []byte) []byte {
+			return data(1)
+		}, 3), "1 2 3 k=4")
+
+		check(reg.RepStrNth(s, []byte("v$1"), 1), "v1 k=2 k=3 k=4")
+		check(reg.RepStrNth(s, []byte("v$1"), 3), "k=1 k=2 v3 k=4")
+		check(reg.RepStrNth(s, []byte("v$1"), -1), "k=1 k=2 k=3 v4")
+		check(reg.RepStrNth(s, []byte("v$1"), -4), "v1 k=2 k=3 k=4")
+		check(reg.RepStrNth(s, []byte("v$1"), 5), "k=1 k=2 k=3 k=4")
+		check(reg.RepStrNth(s, []byte("v$1"), -5), "k=1 k=2 k=3 k=4")
+		check(reg.RepStrLitNth(s, []byte("x"), -2), "k=1 k=2 x k=4")
+		check(reg.RepFuncNth(s, func(data func(int) []byte) []byte {
+			return data(1)
+		}, 2), "k=1 2 k=3 k=4")
+	}
+}
+
+func TestSplitWith(t *testing.T) {
+	type splitter interface {
+		SplitWith(str []byte, opts SplitOptions) [][]byte
+		SplitN(str []byte, n int) [][]byte
+		SplitAfter(str []byte) [][]byte
+		Partition(str []byte) (before []byte, match []byte, after []byte, ok bool)
+	}
+
+	var check = func(res [][]byte, e string) {
+		if r := string(bytes.Join(res, []byte("|"))); r != e {
+			t.Error("[", r, "]\n", errors.New("result does not match expected result: "+e))
+		}
+	}
+
+	for _, reg := range []splitter{Comp(`,(;)?`), CompRE2(`,(;)?`)} {
+		check(reg.SplitWith([]byte("a,,b,"), SplitOptions{}), "a||b")
+		check(reg.SplitWith([]byte("a,,b,"), SplitOptions{KeepEmpty: true}), "a||b|")
+		check(reg.SplitWith([]byte("a,,b,"), SplitOptions{KeepEmpty: true, KeepEmptyGroups: true}), "a||||b||")
+		check(reg.SplitWith([]byte("a,,b,"), SplitOptions{KeepEmpty: true, NoGroups: true}), "a||b|")
+		check(reg.SplitWith([]byte("a,;b,c"), SplitOptions{}), "a|;|b|c")
+		check(reg.SplitWith([]byte("a,;b,c"), SplitOptions{NoGroups: true}), "a|b|c")
+		check(reg.SplitWith([]byte("a,b,c,d"), SplitOptions{Limit: 2}), "a|b,c,d")
+
+		check(reg.SplitN([]byte("a,b,c,d"), 3), "a|b|c,d")
+		check(reg.SplitN([]byte("a,b,c,d"), -1), "a|b|c|d")
+		check(reg.SplitN([]byte("a,;b,;c,;d"), 3), "a|;|b,;c,;d")
+		check(reg.SplitN([]byte("a,;b,;c,;d"), 4), "a|;|b,;c,;d")
+		check(reg.SplitN([]byte("a,;b,;c,;d"), 5), "a|;|b|;|c,;d")
+		if res := reg.SplitN([]byte("a,b"), 0); res != nil {
+			t.Error("[", res, "]\n", errors.New("expected nil"))
+		}
+
+		check(reg.SplitAfter([]byte("a,b,;c")), "a,|b,;|c")
+		check(reg.SplitAfter([]byte("a,b,")), "a,|b,")
+
+		before, match, after, ok := reg.Partition([]byte("key,;value,x"))
+		if !ok || string(before) != "key" || string(match) != ",;" || string(after) != "value,x" {
+			t.Error("[", string(before), string(match), string(after), "]\n", errors.New("result does not match expected result"))
+		}
+		if before, _, _, ok := reg.Partition([]byte("key")); ok || string(before) != "key" {
+			t.Error("[", string(before), "]\n", errors.New("expected no match"))
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	type streamer interface {
+		RepStr(str []byte, rep []byte) []byte
+		RepStrStream(dst io.Writer, src io.Reader, rep []byte, maxReSize ...int64) (int, error)
+		RepFuncStream(dst io.Writer, src io.Reader, rep func(data func(int) []byte) []byte, maxReSize ...int64) (int, error)
+	}
+
+	// matches cross the 64K chunk boundaries
+	s := []byte(strings.Repeat("some text with a key=value pair\n", 10000))
+
+	for _, reg := range []streamer{Comp(`key=(\w+)`), CompRE2(`key=(\w+)`)} {
+		var buf bytes.Buffer
+		count, err := reg.RepStrStream(&buf, iotest.HalfReader(bytes.NewReader(s)), []byte("val=$1!"))
+		if err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to replace stream"))
+		}
+		if count != 10000 || !bytes.Equal(buf.Bytes(), reg.RepStr(s, []byte("val=$1!"))) {
+			t.Error("[", count, "]\n", errors.New("stream result does not match expected result"))
+		}
+
+		buf.Reset()
+		i := 0
+		count, err = reg.RepFuncStream(&buf, bytes.NewReader(s), func(data func(int) []byte) []byte {
+			i++
+			if i > 2 {
+				return nil
+			}
+			return data(1)
+		})
+		if err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to replace stream"))
+		}
+		e := bytes.Replace(s, []byte("key=value"), []byte("value"), 2)
+		e = bytes.Replace(e, []byte("key=value"), []byte(""), 1)
+		if count != 3 || !bytes.Equal(buf.Bytes(), e) {
+			t.Error("[", count, "]\n", errors.New("stream result does not match expected result"))
+		}
+
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(errors.New("broken pipe"))
+		}()
+		if _, err := reg.RepStrStream(io.Discard, pr, []byte("")); err == nil || err.Error() != "broken pipe" {
+			t.Error("[", err, "]\n", errors.New("expected read error"))
+		}
+	}
+
+	// the second chunk starts at 64512 (64K minus the 1024 byte window),
+	// and the end of the first chunk is still the text before it
+	s = []byte(strings.Repeat("a", 64512) + "b" + strings.Repeat("a", 2000) + "\nb")
+	for _, re := range []string{`^b`, `\bb`, `(?m)^b`, `aaa`, `x*`, `a+b`} {
+		for _, reg := range []streamer{Comp(re), CompRE2(re)} {
+			var buf bytes.Buffer
+			if _, err := reg.RepStrStream(&buf, bytes.NewReader(s), []byte("-")); err != nil {
+				t.Error("[", err, "]\n", errors.New("failed to replace stream"))
+			}
+			if !bytes.Equal(buf.Bytes(), reg.RepStr(s, []byte("-"))) {
+				t.Error("[", re, "]\n", errors.New("stream result does not match expected result at a chunk boundary"))
+			}
+		}
+	}
+}
+
+func TestAtomic(t *testing.T) {
+	type atomicRep interface {
+		RepStr(str []byte, rep []byte) []byte
+		RepFileStrAtomic(path string, rep []byte, all bool, opts ...FileOptions) (int, error)
+		RepFileFuncAtomic(path string, rep func(data func(int) []byte) []byte, all bool, opts ...FileOptions) (int, error)
+	}
+
+	s := []byte(strings.Repeat("some text with a key=value pair\n", 10000))
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	for _, reg := range []atomicRep{Comp(`key=(\w+)`), CompRE2(`key=(\w+)`)} {
+		dir := t.TempDir()
+		path := dir + "/atomic.txt"
+		if err := os.WriteFile(path, s, 0640); err != nil {
+			t.Fatal(err)
+		}
+		os.Chmod(path, 0750|os.ModeSetgid)
+		os.Chtimes(path, mtime, mtime)
+
+		count, err := reg.RepFileStrAtomic(path, []byte("val=$1!"), true, FileOptions{KeepOwner: true, KeepModTime: true})
+		if err != nil || count != 10000 {
+			t.Error("[", count, err, "]\n", errors.New("failed to replace file"))
+		}
+		if b, _ := os.ReadFile(path); !bytes.Equal(b, reg.RepStr(s, []byte("val=$1!"))) {
+			t.Error(errors.New("file result does not match expected result"))
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the owner is set before the mode, since chown clears the setgid bit
+		if info.Mode()&(os.ModePerm|os.ModeSetgid) != 0750|os.ModeSetgid {
+			t.Error("[", info.Mode(), "]\n", errors.New("file permissions were not kept"))
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Error("[", info.ModTime(), "]\n", errors.New("file mtime was not kept"))
+		}
+
+		if count, err := reg.RepFileStrAtomic(path, []byte("x"), true); count != 0 || err != nil {
+			t.Error("[", count, err, "]\n", errors.New("expected no match"))
+		}
+
+		os.WriteFile(path, s, 0640)
+		count, err = reg.RepFileFuncAtomic(path, func(data func(int) []byte) []byte {
+			return []byte("first")
+		}, false)
+		if err != nil || count != 1 {
+			t.Error("[", count, err, "]\n", errors.New("failed to replace file"))
+		}
+		if b, _ := os.ReadFile(path); !bytes.Equal(b, bytes.Replace(s, []byte("key=value"), []byte("first"), 1)) {
+			t.Error(errors.New("file result does not match expected result"))
+		}
+
+		if _, err := reg.RepFileStrAtomic(dir+"/missing.txt", []byte("x"), true); !errors.Is(err, os.ErrNotExist) {
+			t.Error("[", err, "]\n", errors.New("expected not exist error"))
+		}
+
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Error("[", len(entries), "]\n", errors.New("temp file was not removed"))
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	type scanner interface {
+		MatchFile(file *os.File, maxReSize ...int64) bool
+		MatchReader(r io.Reader, maxReSize ...int64) (bool, error)
+		FindReader(r io.Reader, maxReSize ...int64) (*Match, int64, error)
+	}
+
+	// the match crosses the first 64K chunk boundary
+	s := append(bytes.Repeat([]byte("-"), 65530), []byte("key=value-----")...)
+	s = append(s, bytes.Repeat([]byte("-"), 100000)...)
+
+	for _, reg := range []scanner{Comp(`key=(\w+)`), CompRE2(`key=(\w+)`)} {
+		if ok, err := reg.MatchReader(iotest.HalfReader(bytes.NewReader(s))); !ok || err != nil {
+			t.Error("[", ok, err, "]\n", errors.New("expected a match"))
+		}
+
+		m, offset, err := reg.FindReader(io.NewSectionReader(bytes.NewReader(s), 0, int64(len(s))))
+		if err != nil || m == nil {
+			t.Fatal("[", err, "]\n", errors.New("expected a match"))
+		}
+		if offset != 65530 || string(m.Bytes()) != "key=value" || string(m.Group(1)) != "value" {
+			t.Error("[", offset, string(m.Bytes()), "]\n", errors.New("result does not match expected result"))
+		}
+
+		empty := bytes.Repeat([]byte("-"), 200000)
+		if ok, err := reg.MatchReader(bytes.NewReader(empty)); ok || err != nil {
+			t.Error("[", ok, err, "]\n", errors.New("expected no match"))
+		}
+		if m, offset, err := reg.FindReader(bytes.NewReader(empty)); m != nil || offset != -1 || err != nil {
+			t.Error("[", offset, err, "]\n", errors.New("expected no match"))
+		}
+
+		file, err := os.CreateTemp(t.TempDir(), "reader")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		file.Write(s)
+		if !reg.MatchFile(file) {
+			t.Error(errors.New("expected a file match"))
+		}
+	}
+
+	// the second chunk starts with the "b" at 64512, which is not the start of the input or of a word
+	s = []byte(strings.Repeat("a", 64512) + "b" + strings.Repeat("a", 2000) + " b")
+	for _, reg := range []scanner{Comp(`^b`), CompRE2(`^b`), Comp(`(?m)^b`), CompRE2(`(?m)^b`)} {
+		if ok, err := reg.MatchReader(bytes.NewReader(s)); ok || err != nil {
+			t.Error("[", ok, err, "]\n", errors.New("expected no match at a chunk boundary"))
+		}
+	}
+	for _, reg := range []scanner{Comp(`\bb`), CompRE2(`\bb`)} {
+		if m, offset, err := reg.FindReader(bytes.NewReader(s)); m == nil || offset != int64(len(s)-1) || err != nil {
+			t.Error("[", offset, err, "]\n", errors.New("result does not match expected result at a chunk boundary"))
+		}
+
+		file, err := os.CreateTemp(t.TempDir(), "reader")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		file.Write(s[:len(s)-2])
+		if reg.MatchFile(file) {
+			t.Error(errors.New("expected no file match at a chunk boundary"))
+		}
+	}
+}
+
+func TestFindAllFile(t *testing.T) {
+	type fileFinder interface {
+		FindAllFile(file *os.File, contextLines int, maxReSize ...int64) ([]*FileMatch, error)
+		FindAllReader(r io.Reader, contextLines int, maxReSize ...int64) ([]*FileMatch, error)
+	}
+
+	var check = func(m *FileMatch, offset int64, line int, column int, text string, before string, after string) {
+		if m.Offset != offset || m.Line != line || m.Column != column {
+			t.Error("[", m.Offset, m.Line, m.Column, "]\n", errors.New("match position does not match expected result"))
+		}
+		if string(m.Text) != text {
+			t.Error("[", string(m.Text), "]\n", errors.New("match lines do not match expected result: "+text))
+		}
+		if b := string(bytes.Join(m.Before, []byte("|"))); b != before {
+			t.Error("[", b, "]\n", errors.New("before lines do not match expected result: "+before))
+		}
+		if a := string(bytes.Join(m.After, []byte("|"))); a != after {
+			t.Error("[", a, "]\n", errors.New("after lines do not match expected result: "+after))
+		}
+	}
+
+	s := []byte("a\nb key=1\nc\nd key=2 x\ne\nkey=3\nf")
+
+	for _, reg := range []fileFinder{Comp(`key=(\d)`), CompRE2(`key=(\d)`)} {
+		res, err := reg.FindAllReader(bytes.NewReader(s), 1)
+		if err != nil || len(res) != 3 {
+			t.Fatal("[", len(res), err, "]\n", errors.New("expected 3 matches"))
+		}
+		check(res[0], 4, 2, 3, "b key=1", "a", "c")
+		check(res[1], 14, 4, 3, "d key=2 x", "c", "e")
+		check(res[2], 24, 6, 1, "key=3", "e", "f")
+		if string(res[1].Bytes()) != "key=2" || string(res[1].Group(1)) != "2" {
+			t.Error("[", string(res[1].Bytes()), "]\n", errors.New("result does not match expected result"))
+		}
+
+		res, err = reg.FindAllReader(bytes.NewReader(s), 0)
+		if err != nil || len(res) != 3 || res[2].Before != nil || res[2].After != nil {
+			t.Error("[", len(res), err, "]\n", errors.New("expected no context lines"))
+		}
+		if len(res) == 3 {
+			check(res[1], 14, 4, 3, "d key=2 x", "", "")
+		}
+
+		// matches on the same line have the same text
+		if res, err := reg.FindAllReader(strings.NewReader("a\nb key=1 key=2\nc"), 0); err != nil || len(res) != 2 {
+			t.Error("[", len(res), err, "]\n", errors.New("expected 2 matches"))
+		} else {
+			check(res[0], 4, 2, 3, "b key=1 key=2", "", "")
+			check(res[1], 10, 2, 9, "b key=1 key=2", "", "")
+		}
+
+		// the lines cross the 64K chunk boundaries
+		big := []byte(strings.Repeat("some text\nwith a key=1 pair\n", 10000))
+		file, err := os.CreateTemp(t.TempDir(), "findall")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		file.Write(big)
+
+		res, err = reg.FindAllFile(file, 2)
+		if err != nil || len(res) != 10000 {
+			t.Fatal("[", len(res), err, "]\n", errors.New("expected 10000 matches"))
+		}
+		for i, m := range res {
+			if m.Line != i*2+2 || m.Column != 8 || m.Offset != int64(i*28+17) {
+				t.Error("[", i, m.Line, m.Column, m.Offset, "]\n", errors.New("match position does not match expected result"))
+				break
+			}
+		}
+		check(res[5000], 5000*28+17, 10002, 8, "with a key=1 pair", "with a key=1 pair|some text", "some text|with a key=1 pair")
+		check(res[9999], 9999*28+17, 20000, 8, "with a key=1 pair", "with a key=1 pair|some text", "")
+	}
+
+	// a match over more than one line has all of its lines
+	for _, reg := range []fileFinder{Comp(`1\nc`), CompRE2(`1\nc`)} {
+		res, err := reg.FindAllReader(bytes.NewReader(s), 1)
+		if err != nil || len(res) != 1 {
+			t.Error("[", len(res), err, "]\n", errors.New("expected 1 match"))
+			continue
+		}
+		check(res[0], 8, 2, 7, "b key=1\nc", "a", "d key=2 x")
+	}
+}
+
+func TestDir(t *testing.T) {
+	type dirWalker interface {
+		FindAllDir(root string, contextLines int, opts ...WalkOptions) ([]*DirResult, error)
+		RepDirStr(root string, rep []byte, opts ...WalkOptions) ([]*DirResult, error)
+	}
+
+	for _, reg := range []dirWalker{Comp(`key=(\d+)`), CompRE2(`key=(\d+)`)} {
+		root := t.TempDir()
+		for name, data := range map[string]string{
+			"a.txt":          "key=1",
+			"b.go":           "key=2",
+			"bin.dat":        "key=3\x00",
+			".gitignore":     "ignored/\n*.log\n!keep.log\n",
+			"x.log":          "key=4",
+			"keep.log":       "key=5",
+			"ignored/c.go":   "key=6",
+			"sub/d.txt":      "key=7\nkey=8",
+			"sub/.gitignore": "/e.txt\n",
+			"sub/e.txt":      "key=9",
+			"vendor/f.txt":   "key=10",
+			".git/config":    "key=11",
+		} {
+			os.MkdirAll(root+"/"+name[:strings.LastIndex("/"+name, "/")], 0755)
+			if err := os.WriteFile(root+"/"+name, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		os.Symlink(root+"/a.txt", root+"/link.txt")
+
+		var check = func(res []*DirResult, e string) {
+			list := []string{}
+			for _, r := range res {
+				if r.Err != nil {
+					t.Error("[", r.Path, r.Err, "]\n", errors.New("unexpected file error"))
+				}
+				rel, _ := filepath.Rel(root, r.Path)
+				list = append(list, filepath.ToSlash(rel)+":"+strconv.Itoa(r.Count))
+			}
+			if r := strings.Join(list, ","); r != e {
+				t.Error("[", r, "]\n", errors.New("result does not match expected result: "+e))
+			}
+		}
+
+		res, err := reg.FindAllDir(root, 0, WalkOptions{Exclude: []string{"vendor"}, Workers: 2})
+		if err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to walk dir"))
+		}
+		check(res, "a.txt:1,b.go:1,keep.log:1,sub/d.txt:2")
+		if len(res) == 4 && string(res[3].Matches[1].Group(1)) != "8" {
+			t.Error("[", string(res[3].Matches[1].Bytes()), "]\n", errors.New("result does not match expected result"))
+		}
+
+		res, _ = reg.FindAllDir(root, 0, WalkOptions{Include: []string{"*.txt"}})
+		check(res, "a.txt:1,sub/d.txt:2,vendor/f.txt:1")
+
+		res, _ = reg.FindAllDir(root, 0, WalkOptions{Include: []string{"sub/**"}, NoGitignore: true})
+		check(res, "sub/d.txt:2,sub/e.txt:1")
+
+		res, _ = reg.FindAllDir(root, 0, WalkOptions{Include: []string{"*.dat"}, Binary: true})
+		check(res, "bin.dat:1")
+
+		res, err = reg.RepDirStr(root, []byte("val=$1"), WalkOptions{Include: []string{"*.txt"}, Exclude: []string{"vendor/"}})
+		if err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to walk dir"))
+		}
+		check(res, "a.txt:1,sub/d.txt:2")
+		if b, _ := os.ReadFile(root + "/sub/d.txt"); string(b) != "val=7\nval=8" {
+			t.Error("[", string(b), "]\n", errors.New("file result does not match expected result"))
+		}
+		if info, err := os.Lstat(root + "/link.txt"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Error(errors.New("symlink was replaced"))
+		}
+
+		if _, err := reg.FindAllDir(root+"/missing", 0); !errors.Is(err, os.ErrNotExist) {
+			t.Error("[", err, "]\n", errors.New("expected not exist error"))
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	type dryRunner interface {
+		RepStrDryRun(str []byte, rep []byte) *DryRun
+		RepFuncDryRun(str []byte, rep func(data func(int) []byte) []byte) *DryRun
+		RepFileStrDryRun(file *os.File, rep []byte, all bool, maxReSize ...int64) (*DryRun, error)
+	}
+
+	var check = func(d *DryRun, contextLines int, e string) {
+		res, err := d.Diff("file.txt", contextLines)
+		if err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to make diff"))
+		}
+		if string(res) != e {
+			t.Error("[", string(res), "]\n", errors.New("diff does not match expected result:\n"+e))
+		}
+	}
+
+	s := []byte("a\nb\nkey=1\nc\nd\ne\nf\ng\nh\nkey=2\ni\n")
+
+	for _, reg := range []dryRunner{Comp(`key=(\d)`), CompRE2(`key=(\d)`)} {
+		d := reg.RepStrDryRun(s, []byte("val=$1"))
+		if len(d.Hunks) != 2 || d.Hunks[1].Offset != 22 || d.Hunks[1].Line != 10 || string(d.Hunks[1].Old) != "key=2" || string(d.Hunks[1].New) != "val=2" {
+			t.Error("[", d.Hunks, "]\n", errors.New("hunks do not match expected result"))
+		}
+
+		check(d, 1, "--- file.txt\n+++ file.txt\n@@ -2,3 +2,3 @@\n b\n-key=1\n+val=1\n c\n@@ -9,3 +9,3 @@\n h\n-key=2\n+val=2\n i\n")
+		check(d, 3, "--- file.txt\n+++ file.txt\n@@ -1,11 +1,11 @@\n a\n b\n-key=1\n+val=1\n c\n d\n e\n f\n g\n h\n-key=2\n+val=2\n i\n")
+		check(d, 0, "--- file.txt\n+++ file.txt\n@@ -3,1 +3,1 @@\n-key=1\n+val=1\n@@ -10,1 +10,1 @@\n-key=2\n+val=2\n")
+
+		// a match over more than one line, and no newline at the end
+		d = reg.RepStrDryRun([]byte("x\nkey=1\nkey=2"), []byte("val"))
+		check(d, 1, "--- file.txt\n+++ file.txt\n@@ -1,3 +1,3 @@\n x\n-key=1\n-key=2\n\\ No newline at end of file\n+val\n+val\n\\ No newline at end of file\n")
+
+		d = reg.RepFuncDryRun([]byte("key=1\nkey=2\n"), func(data func(int) []byte) []byte {
+			return []byte("line\n")
+		})
+		check(d, 0, "--- file.txt\n+++ file.txt\n@@ -1,2 +1,4 @@\n-key=1\n-key=2\n+line\n+\n+line\n+\n")
+
+		if res, _ := reg.RepStrDryRun([]byte("none"), []byte("x")).Diff("file.txt", 3); len(res) != 0 {
+			t.Error("[", string(res), "]\n", errors.New("expected an empty diff"))
+		}
+
+		file, err := os.CreateTemp(t.TempDir(), "dryrun")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		file.Write(s)
+
+		d, err = reg.RepFileStrDryRun(file, []byte("val=$1"), false)
+		if err != nil || len(d.Hunks) != 1 || d.Hunks[0].Offset != 4 || d.Hunks[0].Line != 3 {
+			t.Error("[", d, err, "]\n", errors.New("hunks do not match expected result"))
+		}
+		check(d, 1, "--- file.txt\n+++ file.txt\n@@ -2,3 +2,3 @@\n b\n-key=1\n+val=1\n c\n")
+		if b, _ := os.ReadFile(file.Name()); !bytes.Equal(b, s) {
+			t.Error(errors.New("dry run modified the file"))
+		}
+
+		// the big file has matches that cross the 64K chunk boundaries
+		big := []byte(strings.Repeat("some text\nwith a key=1 pair\n", 10000))
+		file.Truncate(0)
+		file.WriteAt(big, 0)
+		d, err = reg.RepFileStrDryRun(file, []byte("val=$1"), true)
+		if err != nil || len(d.Hunks) != 10000 || d.Hunks[9999].Offset != 9999*28+17 || d.Hunks[9999].Line != 20000 {
+			t.Error("[", len(d.Hunks), err, "]\n", errors.New("hunks do not match expected result"))
+		}
+
+		file.WriteAt([]byte("changed"), 17)
+		if _, err := d.Diff("file.txt", 3); !errors.Is(err, ErrInputChanged) {
+			t.Error("[", err, "]\n", errors.New("expected input changed error"))
+		}
+	}
+
+	// the diffs must apply with patch, even when a replacement removes the newline at the end of a line
+	if _, err := exec.LookPath("patch"); err != nil {
+		t.Skip("patch not found")
+	}
+
+	var checkPatch = func(d *DryRun, str string, contextLines int, e string) {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, "file.txt"), []byte(str), 0644)
+
+		res, err := d.Diff("file.txt", contextLines)
+		if err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to make diff"))
+			return
+		}
+		os.WriteFile(filepath.Join(dir, "file.patch"), res, 0644)
+
+		cmd := exec.Command("patch", "-s", "-o", "out.txt", "file.txt", "file.patch")
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Error("[", string(res), string(out), "]\n", errors.New("patch did not apply the diff"))
+			return
+		}
+		if b, _ := os.ReadFile(filepath.Join(dir, "out.txt")); string(b) != e {
+			t.Error("[", string(res), string(b), "]\n", errors.New("patched file does not match expected result"))
+		}
+	}
+
+	for _, reg := range []dryRunner{Comp(`key=\d\n`), CompRE2(`key=\d\n`)} {
+		str := "a key=1\nb key=2\nc\nd\ne\nf\ng\nh key=3\ni\n"
+		for _, n := range []int{0, 1, 3} {
+			checkPatch(reg.RepStrDryRun([]byte(str), []byte("")), str, n, "a b c\nd\ne\nf\ng\nh i\n")
+		}
+		checkPatch(reg.RepStrDryRun([]byte("x key=1\n"), []byte("")), "x key=1\n", 3, "x ")
+		checkPatch(reg.RepStrDryRun([]byte("key=1\nkey=2\ny"), []byte("-")), "key=1\nkey=2\ny", 3, "--y")
+	}
+}
+
+func TestJournal(t *testing.T) {
+	type journaled interface {
+		RepFileStr(file *os.File, rep []byte, all bool, maxReSize ...int64) error
+		RepFileStrAtomic(path string, rep []byte, all bool, opts ...FileOptions) (int, error)
+		RepDirStr(root string, rep []byte, opts ...WalkOptions) ([]*DirResult, error)
+	}
+
+	var check = func(path string, e string) {
+		if b, _ := os.ReadFile(path); string(b) != e {
+			t.Error("[", string(b), "]\n", errors.New("file result does not match expected result: "+e))
+		}
+	}
+
+	for _, reg := range []journaled{Comp(`key=(\d+)`), CompRE2(`key=(\d+)`)} {
+		dir := t.TempDir()
+		journalDir := t.TempDir()
+		os.WriteFile(dir+"/a.txt", []byte("key=1"), 0600)
+		os.WriteFile(dir+"/b.txt", []byte("key=2\nkey=3"), 0644)
+		os.Chmod(dir+"/b.txt", 0750|os.ModeSetgid)
+		os.WriteFile(dir+"/c.txt", []byte("none"), 0644)
+
+		j, err := NewJournal(journalDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := reg.RepFileStrAtomic(dir+"/a.txt", []byte("val=$1"), true, FileOptions{Journal: j}); err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to replace file"))
+		}
+		// a second change to the same file keeps the first backup
+		os.WriteFile(dir+"/a.txt", []byte("key=4"), 0600)
+		reg.RepFileStrAtomic(dir+"/a.txt", []byte("val=$1"), true, FileOptions{Journal: j})
+
+		SetJournal(j)
+		file, err := os.OpenFile(dir+"/b.txt", os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reg.RepFileStr(file, []byte("val=$1"), true)
+		file.Close()
+		SetJournal(nil)
+		check(dir+"/b.txt", "val=2\nval=3")
+
+		if _, err := reg.RepDirStr(dir, []byte("x"), WalkOptions{FileOptions: FileOptions{Journal: j}}); err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to walk dir"))
+		}
+
+		if files := j.Files(); len(files) != 2 {
+			t.Error("[", files, "]\n", errors.New("expected 2 files in the journal"))
+		}
+
+		if oj, err := OpenJournal(journalDir, j.ID()); err != nil || len(oj.Files()) != 2 {
+			t.Error("[", err, "]\n", errors.New("failed to open journal"))
+		}
+
+		if err := Undo(journalDir, j.ID()); err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to undo journal"))
+		}
+		check(dir+"/a.txt", "key=1")
+		check(dir+"/b.txt", "key=2\nkey=3")
+		check(dir+"/c.txt", "none")
+		if info, err := os.Stat(dir + "/a.txt"); err != nil || info.Mode().Perm() != 0600 {
+			t.Error("[", info, err, "]\n", errors.New("file permissions were not restored"))
+		}
+		if info, err := os.Stat(dir + "/b.txt"); err != nil || info.Mode()&(os.ModePerm|os.ModeSetgid) != 0750|os.ModeSetgid {
+			t.Error("[", info, err, "]\n", errors.New("file permissions were not restored"))
+		}
+		if _, err := os.Stat(journalDir + "/" + j.ID()); !errors.Is(err, os.ErrNotExist) {
+			t.Error("[", err, "]\n", errors.New("expected journal to be removed"))
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	type lineReplacer interface {
+		MatchLines(r io.Reader, block ...int) ([]int, error)
+		RepLines(dst io.Writer, src io.Reader, rep []byte, block ...int) ([]int, error)
+		RepLinesFunc(dst io.Writer, src io.Reader, rep func(data func(int) []byte) []byte, block ...int) ([]int, error)
+	}
+
+	var check = func(lines []int, err error, e string) {
+		if err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to read lines"))
+		}
+		if r := fmt.Sprint(lines); r != e {
+			t.Error("[", r, "]\n", errors.New("result does not match expected result: "+e))
+		}
+	}
+
+	s := "key = 1\r\nnone\nkey = 2  \r\n\nkey=3"
+
+	for _, reg := range []lineReplacer{Comp(`^key\s*=\s*(\w+)\s*$`), CompRE2(`^key\s*=\s*(\w+)\s*$`)} {
+		lines, err := reg.MatchLines(strings.NewReader(s))
+		check(lines, err, "[1 3 5]")
+
+		lines, err = reg.MatchLines(strings.NewReader(s), 2)
+		check(lines, err, "[3 5]")
+
+		var buf bytes.Buffer
+		lines, err = reg.RepLines(&buf, strings.NewReader(s), []byte("key=$1"))
+		check(lines, err, "[1 3]") // line 5 is already "key=3"
+		if r := buf.String(); r != "key=1\r\nnone\nkey=2\r\n\nkey=3" {
+			t.Error("[", r, "]\n", errors.New("line endings were not kept"))
+		}
+
+		buf.Reset()
+		lines, err = reg.RepLines(&buf, strings.NewReader(s), []byte("$0"))
+		check(lines, err, "[]")
+		if r := buf.String(); r != s {
+			t.Error("[", r, "]\n", errors.New("result does not match expected result: "+s))
+		}
+
+		buf.Reset()
+		lines, err = reg.RepLinesFunc(&buf, strings.NewReader(s+"\n"), func(data func(int) []byte) []byte {
+			return append([]byte("val="), data(1)...)
+		})
+		check(lines, err, "[1 3 5]")
+		if r := buf.String(); r != "val=1\r\nnone\nval=2\r\n\nval=3\n" {
+			t.Error("[", r, "]\n", errors.New("line endings were not kept"))
+		}
+
+		lines, err = reg.MatchLines(strings.NewReader(""))
+		check(lines, err, "[]")
+	}
+
+	reg := Comp(`(?m)^none$\r?\n^key`)
+	lines, err := reg.MatchLines(strings.NewReader(s), 2)
+	check(lines, err, "[]")
+	lines, err = reg.MatchLines(strings.NewReader(s), 3)
+	check(lines, err, "[1]")
+}
+
+func TestCacheLimit(t *testing.T) {
+	defer SetCacheOptions(CacheOptions{})
+
+	evicted := []string{}
+	SetCacheOptions(CacheOptions{MaxEntries: 2, OnEvict: func(key string, reg Engine) {
+		evicted = append(evicted, key)
+	}})
+
+	evicted = evicted[:0]
+	Comp(`cache-limit-a`)
+	Comp(`cache-limit-b`)
+	Comp(`cache-limit-a`)
+	Comp(`cache-limit-c`)
+	if len(evicted) == 0 || evicted[len(evicted)-1] != `cache-limit-b` {
+		t.Error("[", evicted, "]\n", errors.New("expected the least recently used regex to be evicted"))
+	}
+	if n, _ := cache.Len(); n != 2 {
+		t.Error("[", n, "]\n", errors.New("cache has more entries than its limit"))
+	}
+
+	evicted = evicted[:0]
+	CompRE2(`cache-limit-a`)
+	CompRE2(`cache-limit-b`)
+	CompRE2(`cache-limit-c`)
+	if len(evicted) == 0 || evicted[len(evicted)-1] != `cache-limit-a` {
+		t.Error("[", evicted, "]\n", errors.New("expected the least recently used regex to be evicted"))
+	}
+
+	for _, size := range []int64{Comp(`cache-limit-(\w+)`).memSize(), CompRE2(`cache-limit-(\w+)`).memSize()} {
+		if size <= int64(len(`cache-limit-(\w+)`)) {
+			t.Error("[", size, "]\n", errors.New("expected the compiled size to be more than the pattern"))
+		}
+	}
+
+	SetCacheOptions(CacheOptions{MaxBytes: CompRE2(`cache-limit-[x]`).memSize() + 1})
+	CompRE2(`cache-limit-[y]`)
+	if n, size := cacheRE2.Len(); n != 1 || size > CompRE2(`cache-limit-[x]`).memSize()+1 {
+		t.Error("[", n, size, "]\n", errors.New("cache is over its byte budget"))
+	}
+
+	// a value that grows after it was added (ie: a regex compiled again with JIT) is measured again by Resize
+	c := common.NewCache[*bytes.Buffer]()
+	c.SetOptions(common.CacheOptions[*bytes.Buffer]{MaxBytes: 10, Size: func(b *bytes.Buffer) int64 {
+		return int64(b.Len())
+	}})
+	a, b := bytes.NewBufferString("aaaa"), bytes.NewBufferString("bbbb")
+	c.Set("a", a, nil)
+	c.Set("b", b, nil)
+	b.WriteString("bbbb")
+	c.Resize("b")
+	if n, size := c.Len(); n != 1 || size != 8 {
+		t.Error("[", n, size, "]\n", errors.New("cache size was not updated by Resize"))
+	}
+	if val, _ := c.Peek("a"); val != nil {
+		t.Error(errors.New("expected the least recently used value to be evicted after Resize"))
+	}
+
+	// the JIT copy is only counted if PCRE was built with JIT support
+	SetCacheOptions(CacheOptions{})
+	SetJITThreshold(1)
+	reg := Comp(`cache-limit-jit`)
+	reg.Match([]byte("cache-limit-jit"))
+	reg.Match([]byte("cache-limit-jit"))
+	SetJITThreshold(0)
+	for _, e := range cache.Snapshot() {
+		if e.Key == `cache-limit-jit` && reg.JIT() && e.Size != reg.memSize() {
+			t.Error("[", e.Size, reg.memSize(), "]\n", errors.New("cache size does not count the JIT copy"))
+		}
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	before := Stats()
+
+	Comp(`cache-stats-(\w+)`)
+	Comp(`cache-stats-(\w+)`)
+	CompTry(`cache-stats-(`)
+	CompRE2(`cache-stats-(\w+)`)
+	CompTryRE2(`cache-stats-(?<`)
+
+	stats := Stats()
+	if stats.PCRE.Misses-before.PCRE.Misses != 2 || stats.PCRE.Hits-before.PCRE.Hits != 1 || stats.PCRE.Errors-before.PCRE.Errors != 1 {
+		t.Error("[", stats.PCRE, "]\n", errors.New("pcre stats do not match expected stats"))
+	}
+	if stats.RE2.Misses-before.RE2.Misses != 2 || stats.RE2.Errors-before.RE2.Errors != 1 {
+		t.Error("[", stats.RE2, "]\n", errors.New("re2 stats do not match expected stats"))
+	}
+	if stats.PCRE.CompileTime <= before.PCRE.CompileTime || stats.PCRE.Entries == 0 {
+		t.Error("[", stats.PCRE, "]\n", errors.New("expected compile time and entries"))
+	}
+	if stats.Preprocessor.Hits <= before.Preprocessor.Hits {
+		t.Error("[", stats.Preprocessor, "]\n", errors.New("expected preprocessor hits"))
+	}
+
+	snap := Snapshot()
+	found := false
+	for _, e := range snap.PCRE {
+		if e.Key == `cache-stats-(\w+)` {
+			found = true
+			if e.Hits != 1 || e.LastUse.IsZero() {
+				t.Error("[", e, "]\n", errors.New("snapshot entry does not match expected entry"))
+			}
+		} else if e.Key == `cache-stats-(` && e.Err == "" {
+			t.Error("[", e, "]\n", errors.New("expected snapshot entry to have an error"))
+		}
+	}
+	if !found {
+		t.Error(errors.New("expected pattern in snapshot"))
+	}
+
+	if v := expvar.Get("goregex"); v == nil || !strings.Contains(v.String(), `"Hits"`) {
+		t.Error("[", v, "]\n", errors.New("expected stats to be published with expvar"))
+	}
+}
+
+func TestCachePolicy(t *testing.T) {
+	defer StartSweeper()
+	defer SetCachePolicy(DefaultCachePolicy())
+
+	var mu sync.Mutex
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	freeMB := 1000.0
+	SetCachePolicy(CachePolicy{
+		TTL:        time.Hour,
+		Tiers:      []CacheTier{{MinFreeMB: 100, TTL: 30 * time.Minute}, {MinFreeMB: 0, TTL: 5 * time.Minute}},
+		Clock:      clock,
+		FreeMemory: func() float64 { return freeMB },
+	})
+
+	var cached = func(key string) bool {
+		for _, e := range Snapshot().PCRE {
+			if e.Key == key {
+				return true
+			}
+		}
+		return false
+	}
+
+	if p := GetCachePolicy(); p.Interval != 10*time.Minute || p.Tiers[0].MinFreeMB != 0 {
+		t.Error("[", p, "]\n", errors.New("policy does not match expected policy"))
+	}
+
+	Comp(`cache-policy-a`)
+	advance(20 * time.Minute)
+	Comp(`cache-policy-b`)
+	advance(15 * time.Minute)
+	SweepCache()
+	if cached(`cache-policy-a`) || !cached(`cache-policy-b`) {
+		t.Error(errors.New("expected only the regex older than the TTL to be removed"))
+	}
+
+	freeMB = 50
+	advance(6 * time.Minute)
+	SweepCache()
+	if cached(`cache-policy-b`) {
+		t.Error(errors.New("expected the low memory tier to be used"))
+	}
+
+	freeMB = 5
+	Comp(`cache-policy-c`)
+	SweepCache()
+	if n, _ := cache.Len(); n != 0 {
+		t.Error("[", n, "]\n", errors.New("expected critical memory to clear the cache"))
+	}
+
+	StopSweeper()
+	StopSweeper()
+	SetCachePolicy(CachePolicy{Interval: time.Millisecond, CriticalFreeMB: -1, Clock: clock, FreeMemory: func() float64 { return 0 }})
+	StartSweeper()
+	Comp(`cache-policy-d`)
+	advance(3 * time.Hour)
+	for i := 0; i < 100 && cached(`cache-policy-d`); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if cached(`cache-policy-d`) {
+		t.Error(errors.New("expected the sweeper to remove the regex"))
+	}
+
+	SetCachePolicy(CachePolicy{Disabled: true})
+	StartSweeper()
+	sweeper.mu.Lock()
+	running := sweeper.stop != nil
+	sweeper.mu.Unlock()
+	if running {
+		t.Error(errors.New("expected a disabled sweeper to stay stopped"))
+	}
+}
+
+func TestCgroupMemory(t *testing.T) {
+	defer common.SetSysRoot("")
+
+	var write = func(root string, files map[string]string) {
+		for name, data := range files {
+			os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755)
+			if err := os.WriteFile(filepath.Join(root, name), []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var check = func(root string, limit uint64, usage uint64, ok bool) {
+		common.SetSysRoot(root)
+		if l, u, o := common.CgroupMemory(); l != limit || u != usage || o != ok {
+			t.Error("[", l, u, o, "]\n", errors.New("cgroup memory does not match expected memory"))
+		}
+	}
+
+	const mb = 1024 * 1024
+
+	// cgroup v2, with a limit on the parent cgroup
+	root := t.TempDir()
+	write(root, map[string]string{
+		"proc/self/cgroup":                        "0::/app/worker\n",
+		"sys/fs/cgroup/memory.max":                "max\n",
+		"sys/fs/cgroup/app/memory.max":            "536870912\n",
+		"sys/fs/cgroup/app/worker/memory.max":     "max\n",
+		"sys/fs/cgroup/app/worker/memory.current": "268435456\n",
+		"sys/fs/cgroup/app/worker/memory.stat":    "anon 1\ninactive_file 67108864\nactive_file 2\n",
+	})
+	check(root, 512*mb, 192*mb, true)
+	if free := common.SysFreeMemory(); free > 320 || free <= 0 {
+		t.Error("[", free, "]\n", errors.New("expected free memory to be limited by the cgroup"))
+	}
+
+	// cgroup v1 in a cgroup namespace, with no limit
+	root = t.TempDir()
+	write(root, map[string]string{
+		"proc/self/cgroup":                           "12:cpu,cpuacct:/docker/abc\n11:memory:/docker/abc\n0::/\n",
+		"sys/fs/cgroup/memory/memory.limit_in_bytes": "9223372036854771712\n",
+		"sys/fs/cgroup/memory/memory.usage_in_bytes": "1048576\n",
+	})
+	check(root, 0, 0, false)
+
+	write(root, map[string]string{
+		"sys/fs/cgroup/memory/memory.limit_in_bytes": "1048576\n",
+		"sys/fs/cgroup/memory/memory.usage_in_bytes": "2097152\n",
+		"sys/fs/cgroup/memory/memory.stat":           "cache 1\ntotal_inactive_file 524288\n",
+	})
+	check(root, mb, 1536*1024, true)
+	if free := common.SysFreeMemory(); free != 0.01 {
+		t.Error("[", free, "]\n", errors.New("expected a full cgroup to have the lowest free memory"))
+	}
+	if ttl := DefaultCachePolicy().ttl(common.SysFreeMemory()); ttl != 10*time.Minute {
+		t.Error("[", ttl, "]\n", errors.New("expected the lowest memory tier"))
+	}
+
+	check(t.TempDir(), 0, 0, false)
+}
+
+func TestPreload(t *testing.T) {
+	err := Preload(`preload-(\w+)`, `preload-(`, `preload-[a-z]`, `preload-[`)
+	if err == nil || !strings.Contains(err.Error(), `"preload-("`) || !strings.Contains(err.Error(), `"preload-["`) || strings.Contains(err.Error(), `"preload-[a-z]"`) {
+		t.Error("[", err, "]\n", errors.New("expected an error for every bad pattern"))
+	}
+	if err := PreloadRE2(`preload-(\w+)`, `preload-(?P<name>\d)`); err != nil {
+		t.Error("[", err, "]\n", errors.New("failed to preload re2"))
+	}
+
+	Comp(`preload-(?<name>\w+)`)
+	CompWith(Options{JIT: true}, `preload-jit-(\d)`)
+	path := t.TempDir() + "/cache.json"
+	if err := SaveCache(path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if bytes.Contains(data, []byte(`"bytecode"`)) {
+		t.Error(errors.New("expected only the patterns to be saved"))
+	}
+
+	var load = func(path string) {
+		cache.DelOld(0)
+		cacheRE2.DelOld(0)
+		before := Stats()
+
+		if err := LoadCache(path); err != nil {
+			t.Error("[", err, "]\n", errors.New("failed to load cache"))
+		}
+
+		stats := Stats()
+		if stats.PCRE.Misses != before.PCRE.Misses {
+			t.Error(errors.New("expected the loaded regex to be cached"))
+		}
+		if n, _ := cache.Len(); n == 0 {
+			t.Error(errors.New("expected the pcre cache to be loaded"))
+		}
+		if n, _ := cacheRE2.Len(); n == 0 {
+			t.Error(errors.New("expected the re2 cache to be loaded"))
+		}
+
+		// a regex compiled with the JIT option is compiled with JIT again
+		jit := false
+		for _, e := range cache.Snapshot() {
+			if reg, _ := cache.Peek(e.Key); reg != nil && strings.Contains(reg.expr, `preload-jit-`) {
+				jit = reg.jitDone.Load()
+			}
+		}
+		if !jit {
+			t.Error(errors.New("expected the jit option to be loaded"))
+		}
+
+		if r := Comp(`preload-(?<name>\w+)`).RepStr([]byte("preload-abc"), []byte("${name}")); string(r) != "abc" {
+			t.Error("[", string(r), "]\n", errors.New("result does not match expected result: abc"))
+		}
+		if r := CompRE2(`preload-(\w+)`).RepStr([]byte("preload-abc"), []byte("$1")); string(r) != "abc" {
+			t.Error("[", string(r), "]\n", errors.New("result does not match expected result: abc"))
+		}
+	}
+
+	load(path)
+
+	// a different pcre version only loads the re2 regex
+	os.WriteFile(path, bytes.Replace(data, []byte(`"pcre":"`), []byte(`"pcre":"0.0 `), 1), 0644)
+	cache.DelOld(0)
+	cacheRE2.DelOld(0)
+	if err := LoadCache(path); !errors.Is(err, ErrPCREVersion) {
+		t.Error("[", err, "]\n", errors.New("expected a pcre version error"))
+	}
+	if n, _ := cache.Len(); n != 0 {
+		t.Error("[", n, "]\n", errors.New("expected the pcre regex to be skipped"))
+	}
+	if n, _ := cacheRE2.Len(); n == 0 {
+		t.Error(errors.New("expected the re2 cache to be loaded"))
+	}
+
+	os.WriteFile(path, []byte(`{"format":99}`), 0644)
+	if err := LoadCache(path); !errors.Is(err, ErrCacheFile) {
+		t.Error("[", err, "]\n", errors.New("expected a cache file error"))
+	}
+	os.WriteFile(path, []byte(`{"format":2,"entries":[{"engine":"other","key":"x","expr":"x"}]}`), 0644)
+	if err := LoadCache(path); !errors.Is(err, ErrCacheFile) {
+		t.Error("[", err, "]\n", errors.New("expected a cache file error"))
+	}
+
+	os.WriteFile(path, []byte(`{"format":99}`), 0644)
+	if err := LoadCache(path); !errors.Is(err, ErrCacheFile) {
+		t.Error("[", err, "]\n", errors.New("expected a cache file error"))
+	}
+
+	if PCREVersion() == "" {
+		t.Error(errors.New("expected a pcre version"))
+	}
+}
@@ -5,50 +5,36 @@ import "strconv"
 // RepFunc replaces a string with the result of a function
 //
 // similar to JavaScript .replace(/re/, function(data){})
-func (reg *Regexp) RepFunc(str []byte, rep func(data func(int) []byte) []byte) []byte {
-	ind := reg.RE.FindAllIndex(str, 0)
-
-	res := []byte{}
-	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.NewMatcher(v, 0)
-
-		if trim == 0 {
-			res = append(res, str[:pos[0]]...)
-		} else {
-			res = append(res, str[trim:pos[0]]...)
-		}
-		trim = pos[1]
-
-		gCache := map[int][]byte{}
-		r := rep(func(g int) []byte {
-			if v, ok := gCache[g]; ok {
-				return v
-			}
-			v := m.Group(g)
-			gCache[g] = v
-			return v
-		})
-
-		if []byte(r) == nil {
-			res = append(res, str[trim:]...)
-			return res
-		}
+func (reg *Regexp) RepFunc(str []byte, rep func(data func(int) []byte) []byte, blank ...bool) []byte {
+	res, _ := repFunc(reg.Matches(str), str, rep, len(blank) != 0)
+	return res
+}
 
-		res = append(res, r...)
+// RepFuncTry is the same as RepFunc, but returns an error if the regex failed to match
+//
+// ie: ErrMatchLimit when the backtracking limit was reached
+func (reg *Regexp) RepFuncTry(str []byte, rep func(data func(int) []byte) []byte, blank ...bool) ([]byte, error) {
+	res, err := repFunc(reg.Matches(str), str, rep, len(blank) != 0)
+	if err != nil {
+		return nil, err
 	}
-
-	res = append(res, str[trim:]...)
-
-	return res
+	return res, nil
 }
 
 // RepStrLit replaces a string with another string
 //
 // note: this function is optimized for performance, and the replacement string does not accept replacements like $1
 func (reg *Regexp) RepStrLit(str []byte, rep []byte) []byte {
-	return reg.RE.ReplaceAll(str, rep, 0)
+	return reg.re().ReplaceAll(str, rep, reg.flags)
+}
+
+// RepStrLitTry is the same as RepStrLit, but returns an error if the regex failed to match
+func (reg *Regexp) RepStrLitTry(str []byte, rep []byte) ([]byte, error) {
+	res, err := repStrLit(reg.Matches(str), str, rep)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 // RepStr is a more complex version of the RepStrLit method
@@ -58,39 +44,76 @@ func (reg *Regexp) RepStrLit(str []byte, rep []byte) []byte {
 // use $0 to use the full regex capture group
 //
 // use ${123} to use numbers with more than one digit
+//
+// use ${name} to use a named capture group like (?<name>re)
 func (reg *Regexp) RepStr(str []byte, rep []byte) []byte {
-	ind := reg.RE.FindAllIndex(str, 0)
+	res, _ := repStr(reg.Matches(str), str, rep)
+	return res
+}
+
+// RepStrTry is the same as RepStr, but returns an error if the regex failed to match
+func (reg *Regexp) RepStrTry(str []byte, rep []byte) ([]byte, error) {
+	res, err := repStr(reg.Matches(str), str, rep)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
 
+// repFunc replaces every match of an iterator with the result of a function
+//
+// if the iterator fails, the rest of the string is kept as is, and the error is returned
+func repFunc(it *MatchIter, str []byte, rep func(data func(int) []byte) []byte, blank bool) ([]byte, error) {
 	res := []byte{}
 	trim := 0
-	for _, pos := range ind {
-		v := str[pos[0]:pos[1]]
-		m := reg.RE.NewMatcher(v, 0)
+	for it.Next() {
+		m := it.Match()
 
-		if trim == 0 {
-			res = append(res, str[:pos[0]]...)
-		} else {
-			res = append(res, str[trim:pos[0]]...)
-		}
-		trim = pos[1]
+		if blank {
+			r := rep(m.data)
 
-		r := regComplexSel.RepFunc(rep, func(data func(int) []byte) []byte {
-			if len(data(1)) != 0 {
-				return data(0)
-			}
-			n := data(2)
-			if len(n) > 1 {
-				n = n[1 : len(n)-1]
+			if []byte(r) == nil {
+				return []byte{}, nil
 			}
-			if i, err := strconv.Atoi(string(n)); err == nil {
-				return m.Group(i)
+		} else {
+			res = append(res, str[trim:m.Start()]...)
+			trim = m.End()
+
+			r := rep(m.data)
+
+			if []byte(r) == nil {
+				res = append(res, str[trim:]...)
+				return res, nil
 			}
-			return []byte{}
-		})
+
+			res = append(res, r...)
+		}
+	}
+
+	if blank {
+		return []byte{}, it.Err()
+	}
+
+	res = append(res, str[trim:]...)
+
+	return res, it.Err()
+}
+
+// repStr replaces every match of an iterator with @rep, after replacing things like $1 with the capture groups
+func repStr(it *MatchIter, str []byte, rep []byte) ([]byte, error) {
+	res := []byte{}
+	trim := 0
+	for it.Next() {
+		m := it.Match()
+
+		res = append(res, str[trim:m.Start()]...)
+		trim = m.End()
+
+		r := m.expand(rep)
 
 		if r == nil {
 			res = append(res, str[trim:]...)
-			return res
+			return res, nil
 		}
 
 		res = append(res, r...)
@@ -98,5 +121,40 @@ func (reg *Regexp) RepStr(str []byte, rep []byte) []byte {
 
 	res = append(res, str[trim:]...)
 
-	return res
+	return res, it.Err()
+}
+
+// repStrLit replaces every match of an iterator with @rep
+func repStrLit(it *MatchIter, str []byte, rep []byte) ([]byte, error) {
+	res := []byte{}
+	trim := 0
+	for it.Next() {
+		m := it.Match()
+
+		res = append(res, str[trim:m.Start()]...)
+		res = append(res, rep...)
+		trim = m.End()
+	}
+
+	res = append(res, str[trim:]...)
+
+	return res, it.Err()
+}
+
+// expand replaces things like $1, ${123} and ${name} in @rep with the capture groups of the match
+func (m *Match) expand(rep []byte) []byte {
+	return regComplexSel.RepFunc(rep, func(data func(int) []byte) []byte {
+		if len(data(1)) != 0 {
+			return data(0)
+		}
+		n := data(2)
+		if len(n) > 1 {
+			n = n[1 : len(n)-1]
+		}
+		i, err := strconv.Atoi(string(n))
+		if err != nil {
+			i = m.nameIndex(string(n))
+		}
+		return m.data(i)
+	})
 }
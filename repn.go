@@ -0,0 +1,206 @@
+package regex
+
+//* PCRE limited replace methods
+
+// RepStrN is the same as RepStr, but only replaces the first @n matches
+//
+// @n: the max number of matches to replace, or -1 to replace all matches
+func (reg *Regexp) RepStrN(str []byte, rep []byte, n int) []byte {
+	res, _ := repN(reg.Matches(str), str, n, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+	return res
+}
+
+// RepStrLitN is the same as RepStrLit, but only replaces the first @n matches
+//
+// @n: the max number of matches to replace, or -1 to replace all matches
+func (reg *Regexp) RepStrLitN(str []byte, rep []byte, n int) []byte {
+	res, _ := repN(reg.Matches(str), str, n, litRep(rep))
+	return res
+}
+
+// RepFuncN is the same as RepFunc, but only replaces the first @n matches
+//
+// returning nil from @rep will stop the loop early (the same as RepFunc)
+//
+// @n: the max number of matches to replace, or -1 to replace all matches
+func (reg *Regexp) RepFuncN(str []byte, rep func(data func(int) []byte) []byte, n int) []byte {
+	res, _ := repN(reg.Matches(str), str, n, func(m *Match) []byte {
+		return rep(m.data)
+	})
+	return res
+}
+
+// RepStrNth is the same as RepStr, but only replaces one match
+//
+// @nth: 1 for the first match, 2 for the second match, -1 for the last match, -2 for the second to last match, etc.
+// if there is no such match, the string is returned unchanged
+func (reg *Regexp) RepStrNth(str []byte, rep []byte, nth int) []byte {
+	res, _ := repNth(reg.Matches(str), str, nth, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+	return res
+}
+
+// RepStrLitNth is the same as RepStrLit, but only replaces one match
+//
+// @nth: 1 for the first match, 2 for the second match, -1 for the last match, -2 for the second to last match, etc.
+// if there is no such match, the string is returned unchanged
+func (reg *Regexp) RepStrLitNth(str []byte, rep []byte, nth int) []byte {
+	res, _ := repNth(reg.Matches(str), str, nth, litRep(rep))
+	return res
+}
+
+// RepFuncNth is the same as RepFunc, but only replaces one match
+//
+// @nth: 1 for the first match, 2 for the second match, -1 for the last match, -2 for the second to last match, etc.
+// if there is no such match, the string is returned unchanged
+func (reg *Regexp) RepFuncNth(str []byte, rep func(data func(int) []byte) []byte, nth int) []byte {
+	res, _ := repNth(reg.Matches(str), str, nth, func(m *Match) []byte {
+		return rep(m.data)
+	})
+	return res
+}
+
+//* RE2 limited replace methods
+
+// RepStrN is the same as RepStr, but only replaces the first @n matches
+//
+// @n: the max number of matches to replace, or -1 to replace all matches
+func (reg *RegexpRE2) RepStrN(str []byte, rep []byte, n int) []byte {
+	res, _ := repN(reg.Matches(str), str, n, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+	return res
+}
+
+// RepStrLitN is the same as RepStrLit, but only replaces the first @n matches
+//
+// @n: the max number of matches to replace, or -1 to replace all matches
+func (reg *RegexpRE2) RepStrLitN(str []byte, rep []byte, n int) []byte {
+	res, _ := repN(reg.Matches(str), str, n, litRep(rep))
+	return res
+}
+
+// RepFuncN is the same as RepFunc, but only replaces the first @n matches
+//
+// returning nil from @rep will stop the loop early (the same as RepFunc)
+//
+// @n: the max number of matches to replace, or -1 to replace all matches
+func (reg *RegexpRE2) RepFuncN(str []byte, rep func(data func(int) []byte) []byte, n int) []byte {
+	res, _ := repN(reg.Matches(str), str, n, func(m *Match) []byte {
+		return rep(m.data)
+	})
+	return res
+}
+
+// RepStrNth is the same as RepStr, but only replaces one match
+//
+// @nth: 1 for the first match, 2 for the second match, -1 for the last match, -2 for the second to last match, etc.
+// if there is no such match, the string is returned unchanged
+func (reg *RegexpRE2) RepStrNth(str []byte, rep []byte, nth int) []byte {
+	res, _ := repNth(reg.Matches(str), str, nth, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+	return res
+}
+
+// RepStrLitNth is the same as RepStrLit, but only replaces one match
+//
+// @nth: 1 for the first match, 2 for the second match, -1 for the last match, -2 for the second to last match, etc.
+// if there is no such match, the string is returned unchanged
+func (reg *RegexpRE2) RepStrLitNth(str []byte, rep []byte, nth int) []byte {
+	res, _ := repNth(reg.Matches(str), str, nth, litRep(rep))
+	return res
+}
+
+// RepFuncNth is the same as RepFunc, but only replaces one match
+//
+// @nth: 1 for the first match, 2 for the second match, -1 for the last match, -2 for the second to last match, etc.
+// if there is no such match, the string is returned unchanged
+func (reg *RegexpRE2) RepFuncNth(str []byte, rep func(data func(int) []byte) []byte, nth int) []byte {
+	res, _ := repNth(reg.Matches(str), str, nth, func(m *Match) []byte {
+		return rep(m.data)
+	})
+	return res
+}
+
+//* shared limited replace methods
+
+// litRep returns a replace function that always returns @rep
+func litRep(rep []byte) func(m *Match) []byte {
+	if rep == nil {
+		// nil would stop the loop early
+		rep = []byte{}
+	}
+	return func(m *Match) []byte {
+		return rep
+	}
+}
+
+// repN replaces up to @n matches of an iterator (n < 0 for all matches) with the result of @rep
+//
+// if @rep returns nil, the match is removed and the rest of the string is kept as is
+func repN(it *MatchIter, str []byte, n int, rep func(m *Match) []byte) ([]byte, error) {
+	res := []byte{}
+	trim := 0
+	count := 0
+	for count != n && it.Next() {
+		m := it.Match()
+
+		res = append(res, str[trim:m.Start()]...)
+		trim = m.End()
+		count++
+
+		r := rep(m)
+		if r == nil {
+			break
+		}
+		res = append(res, r...)
+	}
+
+	res = append(res, str[trim:]...)
+
+	return res, it.Err()
+}
+
+// repNth replaces only the @nth match of an iterator with the result of @rep
+//
+// a negative @nth counts back from the last match, which needs every match to be found first
+func repNth(it *MatchIter, str []byte, nth int, rep func(m *Match) []byte) ([]byte, error) {
+	var m *Match
+	if nth > 0 {
+		for i := 0; i < nth && it.Next(); i++ {
+			if i == nth-1 {
+				m = it.Match()
+			}
+		}
+	} else if nth < 0 {
+		// only keep the last -nth matches
+		last := []*Match{}
+		count := 0
+		for it.Next() {
+			if len(last) < -nth {
+				last = append(last, it.Match())
+			} else {
+				last[count%len(last)] = it.Match()
+			}
+			count++
+		}
+		if count >= -nth {
+			m = last[count%len(last)]
+		}
+	}
+
+	if err := it.Err(); err != nil {
+		return append([]byte{}, str...), err
+	} else if m == nil {
+		return append([]byte{}, str...), nil
+	}
+
+	res := append([]byte{}, str[:m.Start()]...)
+	res = append(res, rep(m)...)
+	res = append(res, str[m.End():]...)
+	return res, nil
+}
@@ -0,0 +1,144 @@
+package regex
+
+// SplitOptions changes how SplitWith splits a string
+//
+// the zero value splits the same way as Split
+type SplitOptions struct {
+	// Limit is the max number of items in the result, and the last item has the rest of the string
+	// (0 for no limit)
+	//
+	// the capture groups added to the result count toward the limit
+	Limit int
+
+	// KeepEmpty keeps the empty field at the end of the string (ie: the last column of "a,b,")
+	//
+	// empty fields between two matches are always kept (ie: "a,,b")
+	KeepEmpty bool
+
+	// KeepEmptyGroups adds the capture groups that did not match anything as empty items, instead of leaving them out
+	KeepEmptyGroups bool
+
+	// NoGroups does not add the capture groups of the matches to the result
+	NoGroups bool
+
+	// After keeps each match at the end of the field before it, instead of removing it
+	// (capture groups are not added, since they are already part of the field)
+	After bool
+}
+
+//* PCRE split methods
+
+// SplitWith is the same as Split, but with options for a limit, empty fields and capture groups
+func (reg *Regexp) SplitWith(str []byte, opts SplitOptions) [][]byte {
+	res, _ := split(reg.Matches(str), str, opts)
+	return res
+}
+
+// SplitN is the same as Split, but returns at most @n items, and the last item has the rest of the string
+//
+// the capture groups added to the result count toward @n (see SplitOptions.Limit)
+//
+// @n: the max number of items, 0 returns nil, and -1 returns all fields
+func (reg *Regexp) SplitN(str []byte, n int) [][]byte {
+	if n == 0 {
+		return nil
+	}
+	res, _ := split(reg.Matches(str), str, SplitOptions{Limit: max(n, 0)})
+	return res
+}
+
+// SplitAfter splits a string after every match, and keeps the matches at the end of each field
+func (reg *Regexp) SplitAfter(str []byte) [][]byte {
+	res, _ := split(reg.Matches(str), str, SplitOptions{After: true})
+	return res
+}
+
+// Partition splits a string at the first match
+//
+// if there is no match, @before is the full string and @ok is false
+func (reg *Regexp) Partition(str []byte) (before []byte, match []byte, after []byte, ok bool) {
+	return partition(reg.Matches(str), str)
+}
+
+//* RE2 split methods
+
+// SplitWith is the same as Split, but with options for a limit, empty fields and capture groups
+func (reg *RegexpRE2) SplitWith(str []byte, opts SplitOptions) [][]byte {
+	res, _ := split(reg.Matches(str), str, opts)
+	return res
+}
+
+// SplitN is the same as Split, but returns at most @n items, and the last item has the rest of the string
+//
+// the capture groups added to the result count toward @n (see SplitOptions.Limit)
+//
+// @n: the max number of items, 0 returns nil, and -1 returns all fields
+func (reg *RegexpRE2) SplitN(str []byte, n int) [][]byte {
+	if n == 0 {
+		return nil
+	}
+	res, _ := split(reg.Matches(str), str, SplitOptions{Limit: max(n, 0)})
+	return res
+}
+
+// SplitAfter splits a string after every match, and keeps the matches at the end of each field
+func (reg *RegexpRE2) SplitAfter(str []byte) [][]byte {
+	res, _ := split(reg.Matches(str), str, SplitOptions{After: true})
+	return res
+}
+
+// Partition splits a string at the first match
+//
+// if there is no match, @before is the full string and @ok is false
+func (reg *RegexpRE2) Partition(str []byte) (before []byte, match []byte, after []byte, ok bool) {
+	return partition(reg.Matches(str), str)
+}
+
+//* shared split methods
+
+// split splits a string on every match of an iterator
+func split(it *MatchIter, str []byte, opts SplitOptions) ([][]byte, error) {
+	res := [][]byte{}
+	trim := 0
+	for it.Next() {
+		m := it.Match()
+
+		field := [][]byte{str[trim:m.Start()]}
+		if opts.After {
+			field[0] = str[trim:m.End()]
+		} else if !opts.NoGroups {
+			for i := 1; i <= m.Groups(); i++ {
+				if g := m.Group(i); len(g) != 0 {
+					field = append(field, g)
+				} else if opts.KeepEmptyGroups {
+					field = append(field, []byte{})
+				}
+			}
+		}
+
+		// the rest of the string always needs one more item
+		if opts.Limit > 0 && len(res)+len(field)+1 > opts.Limit {
+			break
+		}
+
+		res = append(res, field...)
+		trim = m.End()
+	}
+
+	e := str[trim:]
+	if len(e) != 0 || opts.KeepEmpty {
+		res = append(res, e)
+	}
+
+	return res, it.Err()
+}
+
+// partition splits a string at the first match of an iterator
+func partition(it *MatchIter, str []byte) ([]byte, []byte, []byte, bool) {
+	if !it.Next() {
+		return str, nil, nil, false
+	}
+
+	m := it.Match()
+	return str[:m.Start()], str[m.Start():m.End()], str[m.End():], true
+}
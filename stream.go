@@ -0,0 +1,439 @@
+package regex
+
+import (
+	"context"
+	"io"
+
+	"github.com/GRbit/go-pcre"
+)
+
+// matcher lets the stream and file methods share their code between PCRE and RE2
+type matcher interface {
+	matches(str []byte, flags int) *MatchIter
+	matchesFrom(str []byte, pos int, flags int) *MatchIter
+}
+
+// streamChunkSize is the number of bytes read from a stream at a time
+const streamChunkSize = 64 * 1024
+
+// streamContext is the number of bytes before every chunk that are kept as the text before it,
+// so ^, \b and lookbehind assertions at the start of a chunk see the end of the last chunk
+const streamContext = 64
+
+// fileWindow returns the max length of a match, for methods that read a file in chunks
+//
+// this is the same size the RepFile methods have always used
+func fileWindow(reLen int64, maxReSize []int64) int64 {
+	l := int64(reLen * 10)
+	if l < 1024 {
+		l = 1024
+	}
+	for _, maxRe := range maxReSize {
+		if l < maxRe {
+			l = maxRe
+		}
+	}
+	return l
+}
+
+// readChunk appends up to @size bytes from @src to @buf
+//
+// it returns true once @src has no more data
+func readChunk(src io.Reader, buf []byte, size int) ([]byte, bool, error) {
+	start := len(buf)
+	buf = append(buf, make([]byte, size)...)
+
+	n, err := io.ReadFull(src, buf[start:])
+	buf = buf[:start+n]
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return buf, true, nil
+	}
+	return buf, false, err
+}
+
+//* PCRE stream methods
+
+// RepStrStream copies @src to @dst, and replaces every match the same way as RepStr
+//
+// the input is read in chunks, so memory stays bounded for large inputs (ie: pipes, network bodies, gzip readers)
+//
+// a match that crosses the end of a chunk is still found, as long as it is not longer than the max regex size
+//
+// returns the number of replacements
+//
+// @maxReSize: the max length of a match (default: 10x the length of the regex, min 1024)
+func (reg *Regexp) RepStrStream(dst io.Writer, src io.Reader, rep []byte, maxReSize ...int64) (int, error) {
+	return repStream(context.Background(), reg, dst, src, int(fileWindow(reg.len, maxReSize)), -1, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFuncStream copies @src to @dst, and replaces every match with the result of a function, the same as RepFunc
+//
+// returning nil from @rep removes the match, and copies the rest of the input as is
+//
+// returns the number of replacements
+//
+// @maxReSize: the max length of a match (default: 10x the length of the regex, min 1024)
+func (reg *Regexp) RepFuncStream(dst io.Writer, src io.Reader, rep func(data func(int) []byte) []byte, maxReSize ...int64) (int, error) {
+	return repStream(context.Background(), reg, dst, src, int(fileWindow(reg.len, maxReSize)), -1, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+// MatchReader returns true if @r contains a regex match
+//
+// the input is read once through a sliding window, which keeps the last @maxReSize bytes of every chunk
+// for the next one, so a match that crosses the end of a chunk is still found
+//
+// use io.NewSectionReader to scan an io.ReaderAt
+//
+// @maxReSize: the max length of a match (default: 10x the length of the regex, min 1024)
+func (reg *Regexp) MatchReader(r io.Reader, maxReSize ...int64) (bool, error) {
+	return matchStream(context.Background(), reg, r, int(fileWindow(reg.len, maxReSize)))
+}
+
+// FindReader returns the first match in @r, and the byte offset of the match in @r
+//
+// m.Input only has the part of the input used by the match, so m.Start() is not the offset in @r
+//
+// returns a nil match and an offset of -1 if there is no match
+//
+// use io.NewSectionReader to scan an io.ReaderAt
+//
+// @maxReSize: the max length of a match (default: 10x the length of the regex, min 1024)
+func (reg *Regexp) FindReader(r io.Reader, maxReSize ...int64) (*Match, int64, error) {
+	return findStream(context.Background(), reg, r, int(fileWindow(reg.len, maxReSize)))
+}
+
+//* RE2 stream methods
+
+// RepStrStream copies @src to @dst, and replaces every match the same way as RepStr
+//
+// the input is read in chunks, so memory stays bounded for large inputs (ie: pipes, network bodies, gzip readers)
+//
+// a match that crosses the end of a chunk is still found, as long as it is not longer than the max regex size
+//
+// returns the number of replacements
+//
+// @maxReSize: the max length of a match (default: 10x the length of the regex, min 1024)
+func (reg *RegexpRE2) RepStrStream(dst io.Writer, src io.Reader, rep []byte, maxReSize ...int64) (int, error) {
+	return repStream(context.Background(), reg, dst, src, int(fileWindow(reg.len, maxReSize)), -1, func(m *Match) []byte {
+		return m.expand(rep)
+	})
+}
+
+// RepFuncStream copies @src to @dst, and replaces every match with the result of a function, the same as RepFunc
+//
+// returning nil from @rep removes the match, and copies the rest of the input as is
+//
+// returns the number of replacements
+//
+// @maxReSize: the max length of a match (default: 10x the length of the regex, min 1024)
+func (reg *RegexpRE2) RepFuncStream(dst io.Writer, src io.Reader, rep func(data func(int) []byte) []byte, maxReSize ...int64) (int, error) {
+	return repStream(context.Background(), reg, dst, src, int(fileWindow(reg.len, maxReSize)), -1, func(m *Match) []byte {
+		return rep(m.data)
+	})
+}
+
+// MatchReader returns true if @r contains a regex match
+//
+// the input is read once through a sliding window, which keeps the last @maxReSize bytes of every chunk
+// for the next one, so a match that crosses the end of a chunk is still found
+//
+// use io.NewSectionReader to scan an io.ReaderAt
+//
+// @maxReSize: the max length of a match (default: 10x the length of the regex, min 1024)
+func (reg *RegexpRE2) MatchReader(r io.Reader, maxReSize ...int64) (bool, error) {
+	return matchStream(context.Background(), reg, r, int(fileWindow(reg.len, maxReSize)))
+}
+
+// FindReader returns the first match in @r, and the byte offset of the match in @r
+//
+// m.Input only has the part of the input used by the match, so m.Start() is not the offset in @r
+//
+// returns a nil match and an offset of -1 if there is no match
+//
+// use io.NewSectionReader to scan an io.ReaderAt
+//
+// @maxReSize: the max length of a match (default: 10x the length of the regex, min 1024)
+func (reg *RegexpRE2) FindReader(r io.Reader, maxReSize ...int64) (*Match, int64, error) {
+	return findStream(context.Background(), reg, r, int(fileWindow(reg.len, maxReSize)))
+}
+
+//* shared stream methods
+
+// repStream copies @src to @dst, and replaces up to @n matches (n < 0 for all matches) with the result of @rep
+//
+// the input is read in chunks, and the last @window bytes of every chunk are carried over to the next one,
+// so a match up to @window bytes long is still found when it crosses a chunk boundary
+//
+// if @rep returns nil, the match is removed and the rest of the input is copied as is (the same as RepFunc)
+//
+// the last streamContext bytes before the carried over part are also kept as the text before the next chunk,
+// so ^, \b and lookbehind assertions match the same as they would on the whole input (see matchesAfter)
+func repStream(ctx context.Context, reg matcher, dst io.Writer, src io.Reader, window int, n int, rep func(m *Match) []byte) (int, error) {
+	buf := []byte{}
+	eof := false
+	stop := false
+	count := 0
+	flags := 0
+
+	// buf[:skip] was already written, and is only kept as the text before the chunk
+	skip := 0
+	afterMatch := false
+
+	var err error
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+
+		buf, eof, err = readChunk(src, buf, streamChunkSize)
+		if err != nil {
+			return count, err
+		}
+
+		if stop {
+			if _, err := dst.Write(buf); err != nil {
+				return count, err
+			}
+			if eof {
+				return count, nil
+			}
+			buf = buf[:0]
+			continue
+		}
+
+		// only matches that start before the carried over window are final
+		safe := len(buf)
+		if !eof {
+			safe -= window
+			if safe <= skip {
+				continue
+			}
+		}
+
+		trim := skip
+		it := matchesAfter(reg, buf, skip, afterMatch, flags).withContext(ctx)
+		for it.Next() {
+			m := it.Match()
+			if !eof && m.Start() >= safe {
+				break
+			}
+
+			if _, err := dst.Write(buf[trim:m.Start()]); err != nil {
+				return count, err
+			}
+			trim = m.End()
+
+			r := rep(m)
+			count++
+
+			if r == nil {
+				stop = true
+				break
+			}
+
+			if _, err := dst.Write(r); err != nil {
+				return count, err
+			}
+
+			if n >= 0 && count >= n {
+				stop = true
+				break
+			}
+		}
+		if err := it.Err(); err != nil {
+			return count, err
+		}
+
+		if stop || eof {
+			if _, err := dst.Write(buf[trim:]); err != nil {
+				return count, err
+			}
+			if eof {
+				return count, nil
+			}
+			buf = buf[:0]
+			skip = 0
+			continue
+		}
+
+		keep := max(trim, safe)
+		if _, err := dst.Write(buf[trim:keep]); err != nil {
+			return count, err
+		}
+
+		from := max(keep-streamContext, 0)
+		buf = append(buf[:0], buf[from:]...)
+		skip = keep - from
+		afterMatch = trim == keep
+		flags = pcre.NOTBOL
+	}
+}
+
+// matchesAfter returns an iterator for the matches in a chunk of a stream that start at or after @skip
+//
+// str[:skip] is the end of the last chunk, which is only used as the text before the chunk,
+// so the matches that start in it are dropped
+//
+// if a match from str[:skip] runs into the chunk, the chunk is searched again from @skip with matchesFrom,
+// so a match at the start of the chunk is not hidden by it
+//
+// @afterMatch: true if the last match of the last chunk ended at @skip, so an empty match there is dropped (the same as FindAll)
+func matchesAfter(reg matcher, str []byte, skip int, afterMatch bool, flags int) *MatchIter {
+	if skip == 0 {
+		return reg.matches(str, flags)
+	}
+
+	it := reg.matches(str, flags)
+	from := false
+
+	return &MatchIter{str: str, names: it.names, next: func() ([]int, error) {
+		for it.Next() {
+			m := it.Match()
+			if m.Start() < skip {
+				if m.End() > skip && !from {
+					it = reg.matchesFrom(str, skip, flags)
+					from = true
+				}
+				continue
+			}
+
+			if afterMatch && m.Start() == skip && m.End() == skip {
+				continue
+			}
+			return m.Index, nil
+		}
+		return nil, it.Err()
+	}}
+}
+
+// matchStream returns true if @src contains a match
+func matchStream(ctx context.Context, reg matcher, src io.Reader, window int) (bool, error) {
+	found := false
+	err := scanStream(ctx, reg, src, window, func(m *Match, base int64) bool {
+		found = true
+		return false
+	}, nil)
+	return found, err
+}
+
+// findStream returns the first match in @src, and the offset of the match in @src
+func findStream(ctx context.Context, reg matcher, src io.Reader, window int) (*Match, int64, error) {
+	var res *Match
+	offset := int64(-1)
+	err := scanStream(ctx, reg, src, window, func(m *Match, base int64) bool {
+		res, base = m.detach(base)
+		offset = base + int64(res.Start())
+		return false
+	}, nil)
+	if err != nil {
+		return nil, -1, err
+	}
+	return res, offset, nil
+}
+
+// scanStream calls @fn with every match in @src, and the offset of m.Input in @src
+//
+// the input is read once through a sliding window, and the last @window bytes of every chunk
+// are carried over to the next one, with the text before them, the same way as repStream
+//
+// m.Input is reused for the next chunk, so @fn must copy anything it keeps
+//
+// returning false from @fn stops the scan
+//
+// if @seen is not nil, it is called with every part of the input before it is dropped, and the offset of that part in @src
+// (every byte of the input is passed to @seen once, unless the scan was stopped)
+func scanStream(ctx context.Context, reg matcher, src io.Reader, window int, fn func(m *Match, base int64) bool, seen func(b []byte, base int64)) error {
+	buf := []byte{}
+	base := int64(0)
+	eof := false
+	flags := 0
+
+	// buf[:skip] was already scanned, and is only kept as the text before the chunk
+	skip := 0
+	afterMatch := false
+
+	var err error
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		buf, eof, err = readChunk(src, buf, streamChunkSize)
+		if err != nil {
+			return err
+		}
+
+		// only matches that start before the carried over window are final
+		safe := len(buf)
+		if !eof {
+			safe -= window
+			if safe <= skip {
+				continue
+			}
+		}
+
+		keep := safe
+		lastEnd := -1
+		it := matchesAfter(reg, buf, skip, afterMatch, flags).withContext(ctx)
+		for it.Next() {
+			m := it.Match()
+			if !eof && m.Start() >= safe {
+				break
+			}
+			if !fn(m, base) {
+				return nil
+			}
+			keep = max(keep, m.End())
+			lastEnd = m.End()
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+
+		if eof {
+			if seen != nil {
+				seen(buf[skip:], base+int64(skip))
+			}
+			return nil
+		}
+
+		if seen != nil {
+			seen(buf[skip:keep], base+int64(skip))
+		}
+
+		from := max(keep-streamContext, 0)
+		buf = append(buf[:0], buf[from:]...)
+		base += int64(from)
+		skip = keep - from
+		afterMatch = lastEnd == keep
+		flags = pcre.NOTBOL
+	}
+}
+
+// detach returns a copy of a match from scanStream, that only keeps the part of the input used by the match
+//
+// the offset of the new m.Input in the stream is also returned
+func (m *Match) detach(base int64) (*Match, int64) {
+	start, end := m.Start(), m.End()
+	for i := 0; i+1 < len(m.Index); i += 2 {
+		if m.Index[i] >= 0 {
+			start = min(start, m.Index[i])
+			end = max(end, m.Index[i+1])
+		}
+	}
+
+	ind := make([]int, len(m.Index))
+	for i, v := range m.Index {
+		if v >= 0 {
+			v -= start
+		}
+		ind[i] = v
+	}
+
+	return newMatch(append([]byte{}, m.Input[start:end]...), ind, m.Names), base + int64(start)
+}
@@ -0,0 +1,253 @@
+package regex
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tkdeng/goregex/common"
+)
+
+// CachePolicy sets how the cache sweeper removes regex that have not been used in a while
+//
+// the zero value of a field uses its default (see DefaultCachePolicy)
+type CachePolicy struct {
+	// Interval is the time between sweeps (default: 10 minutes)
+	Interval time.Duration
+
+	// TTL is how long a regex can go unused before it is removed,
+	// when the free memory is unknown or no tier matches (default: 2 hours)
+	TTL time.Duration
+
+	// Tiers sets the TTL by the free system memory, so a regex is kept for less time when memory is low
+	//
+	// nil uses the default tiers, and an empty list always uses TTL
+	Tiers []CacheTier
+
+	// CriticalFreeMB clears every cache if the free memory is still below this after a sweep (default: 10)
+	//
+	// a negative value never clears the caches
+	CriticalFreeMB float64
+
+	// CriticalDelay is the time to wait after a sweep before checking for critical memory,
+	// so the garbage collector has time to free the removed regex (default: 10 seconds)
+	CriticalDelay time.Duration
+
+	// Disabled stops the sweeper, and keeps StartSweeper from starting it
+	Disabled bool
+
+	// Clock returns the current time, for the last use time of each regex (default: time.Now)
+	//
+	// this is useful to test the sweeper without waiting
+	Clock func() time.Time
+
+	// FreeMemory returns the free system memory in megabytes, or 0 if it is unknown (default: common.SysFreeMemory)
+	FreeMemory func() float64
+}
+
+// CacheTier is the TTL of the cache when the free system memory is at least MinFreeMB megabytes
+type CacheTier struct {
+	MinFreeMB float64
+	TTL       time.Duration
+}
+
+// DefaultCachePolicy returns the default cache policy
+func DefaultCachePolicy() CachePolicy {
+	return CachePolicy{
+		Interval: 10 * time.Minute,
+		TTL:      2 * time.Hour,
+		Tiers: []CacheTier{
+			// low memory
+			{MinFreeMB: 0, TTL: 10 * time.Minute},
+			{MinFreeMB: 200, TTL: 30 * time.Minute},
+			{MinFreeMB: 500, TTL: 1 * time.Hour},
+			// default
+			{MinFreeMB: 2000, TTL: 2 * time.Hour},
+			// high memory
+			{MinFreeMB: 16000, TTL: 3 * time.Hour},
+			{MinFreeMB: 32000, TTL: 6 * time.Hour},
+			{MinFreeMB: 64000, TTL: 12 * time.Hour},
+		},
+		CriticalFreeMB: 10,
+		CriticalDelay:  10 * time.Second,
+		FreeMemory:     common.SysFreeMemory,
+	}
+}
+
+// sweeper runs the cache sweeps in the background
+var sweeper struct {
+	mu     sync.Mutex
+	policy CachePolicy
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func init() {
+	sweeper.policy = DefaultCachePolicy()
+	StartSweeper()
+}
+
+// SetCachePolicy sets the cache policy, and restarts the sweeper with it if the sweeper is running
+//
+// the clock of the policy is used by the caches right away
+func SetCachePolicy(policy CachePolicy) {
+	def := DefaultCachePolicy()
+	if policy.Interval <= 0 {
+		policy.Interval = def.Interval
+	}
+	if policy.TTL <= 0 {
+		policy.TTL = def.TTL
+	}
+	if policy.Tiers == nil {
+		policy.Tiers = def.Tiers
+	} else {
+		policy.Tiers = append([]CacheTier{}, policy.Tiers...)
+	}
+	sort.SliceStable(policy.Tiers, func(i, j int) bool {
+		return policy.Tiers[i].MinFreeMB < policy.Tiers[j].MinFreeMB
+	})
+	if policy.CriticalFreeMB == 0 {
+		policy.CriticalFreeMB = def.CriticalFreeMB
+	}
+	if policy.CriticalDelay <= 0 {
+		policy.CriticalDelay = def.CriticalDelay
+	}
+	if policy.FreeMemory == nil {
+		policy.FreeMemory = def.FreeMemory
+	}
+
+	sweeper.mu.Lock()
+	running := sweeper.stop != nil
+	sweeper.policy = policy
+	sweeper.mu.Unlock()
+
+	cache.SetClock(policy.Clock)
+	cacheRE2.SetClock(policy.Clock)
+	compCache.SetClock(policy.Clock)
+
+	if running {
+		StopSweeper()
+		StartSweeper()
+	}
+}
+
+// GetCachePolicy returns the current cache policy
+func GetCachePolicy() CachePolicy {
+	sweeper.mu.Lock()
+	defer sweeper.mu.Unlock()
+
+	return sweeper.policy
+}
+
+// StartSweeper starts the background cache sweeper, if it is not running and not disabled by the cache policy
+//
+// the sweeper is started by default
+func StartSweeper() {
+	sweeper.mu.Lock()
+	defer sweeper.mu.Unlock()
+
+	if sweeper.stop != nil || sweeper.policy.Disabled {
+		return
+	}
+
+	policy := sweeper.policy
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	sweeper.stop = stop
+	sweeper.done = done
+
+	go func() {
+		defer close(done)
+
+		timer := time.NewTimer(policy.Interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+			}
+
+			sweep(policy)
+
+			// clear cache if were still critically low on available memory
+			if policy.CriticalFreeMB > 0 {
+				timer.Reset(policy.CriticalDelay)
+				select {
+				case <-stop:
+					return
+				case <-timer.C:
+				}
+				flushCritical(policy)
+			}
+
+			timer.Reset(policy.Interval)
+		}
+	}()
+}
+
+// StopSweeper stops the background cache sweeper, and waits for it to return
+//
+// the caches are kept, and only the cache limits remove regex while the sweeper is stopped (see SetCacheOptions)
+func StopSweeper() {
+	sweeper.mu.Lock()
+	stop, done := sweeper.stop, sweeper.done
+	sweeper.stop, sweeper.done = nil, nil
+	sweeper.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// SweepCache runs one sweep of the caches right away with the current cache policy
+//
+// this works even if the sweeper is stopped or disabled
+func SweepCache() {
+	policy := GetCachePolicy()
+	sweep(policy)
+	flushCritical(policy)
+}
+
+// sweep removes the regex that have not been used within the TTL of the policy
+func sweep(policy CachePolicy) {
+	ttl := policy.ttl(policy.FreeMemory())
+
+	cache.DelOld(ttl)
+	cacheRE2.DelOld(ttl)
+	compCache.DelOld(ttl)
+}
+
+// flushCritical clears every cache if the free memory is below the critical threshold of the policy
+func flushCritical(policy CachePolicy) {
+	if policy.CriticalFreeMB <= 0 {
+		return
+	}
+
+	if mb := policy.FreeMemory(); mb < policy.CriticalFreeMB && mb != 0 {
+		cache.DelOld(0)
+		cacheRE2.DelOld(0)
+		compCache.DelOld(0)
+	}
+}
+
+// ttl returns the TTL of the cache for the free memory in megabytes
+//
+// the tiers must be sorted by MinFreeMB
+func (policy CachePolicy) ttl(mb float64) time.Duration {
+	if mb == 0 {
+		return policy.TTL
+	}
+
+	ttl := policy.TTL
+	for _, tier := range policy.Tiers {
+		if mb < tier.MinFreeMB {
+			break
+		}
+		ttl = tier.TTL
+	}
+	return ttl
+}